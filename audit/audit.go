@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/crud"
+	"github.com/runetid/go-sdk/models"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ActorUser     = "user"
+	ActorAccount  = "account"
+	ActorInternal = "internal"
+	ActorUnknown  = "unknown"
+)
+
+type Config struct {
+	// audited entities by table name, empty audits everything except the audit log itself
+	Entities []string
+	// fields whose values are replaced with Redacted, matched case-insensitively as substrings
+	Redact []string
+}
+
+const Redacted = "[redacted]"
+
+func DefaultConfig() Config {
+	return Config{Redact: []string{"password", "secret", "token", "hash"}}
+}
+
+// Attach records every create, update and delete of the application in the audit log.
+func Attach(app *crud.Application, config Config) {
+	entities := map[string]bool{}
+	for _, e := range config.Entities {
+		entities[e] = true
+	}
+
+	app.OnMutation(func(event crud.MutationEvent) {
+		if event.Entity == (&Entry{}).TableName() || len(entities) > 0 && !entities[event.Entity] {
+			return
+		}
+
+		entry := NewEntry(event, config.Redact)
+		if err := app.Db.WithContext(context.WithoutCancel(event.Ctx)).Create(&entry).Error; err != nil {
+			log.Println("Audit: " + err.Error() + " " + event.Entity + " " + event.Key + " traceId " + entry.TraceID)
+		}
+	})
+}
+
+// NewEntry describes the mutation with the actor taken from the request.
+func NewEntry(event crud.MutationEvent, redact []string) Entry {
+	entry := Entry{
+		CreatedAt: time.Now(),
+		Action:    string(event.Action),
+		Entity:    event.Entity,
+		EntityID:  event.Key,
+		Diff:      Diff(event.Before, event.Model, redact),
+	}
+
+	if event.Action == crud.MutationDelete {
+		entry.Diff = Diff(event.Before, nil, redact)
+	}
+
+	if c := event.Ctx; c != nil {
+		entry.ActorType, entry.ActorID = Actor(c)
+		entry.EventID = c.GetInt64("event_id")
+		entry.Role = c.GetString("role")
+		entry.TraceID = c.GetString("traceId")
+		entry.ClientIP = c.ClientIP()
+	}
+
+	return entry
+}
+
+// Actor returns the user of UserMiddleware, else the api account of AccountMiddleware.
+// Accounts are recorded by id, or by a hash of the key when the id is unknown, the audit log is readable.
+func Actor(c *gin.Context) (string, string) {
+	if u, ok := c.Get("user"); ok {
+		switch u := u.(type) {
+		case models.User:
+			return ActorUser, strconv.Itoa(u.Id)
+		case *models.User:
+			return ActorUser, strconv.Itoa(u.Id)
+		}
+	}
+
+	if id := c.GetInt64("api_account_id"); id != 0 {
+		return ActorAccount, strconv.FormatInt(id, 10)
+	}
+
+	if key := c.GetString("api_key"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return ActorAccount, "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	if c.GetBool("internal") {
+		return ActorInternal, ""
+	}
+
+	return ActorUnknown, ""
+}
+
+// Diff compares the JSON representation of two models field by field.
+func Diff(before interface{}, after interface{}, redact []string) Changes {
+	old, updated := fields(before), fields(after)
+	changes := Changes{}
+
+	for key, value := range old {
+		if v, ok := updated[key]; !ok || !reflect.DeepEqual(value, v) {
+			changes[key] = Change{Old: value, New: v}
+		}
+	}
+	for key, value := range updated {
+		if _, ok := old[key]; !ok {
+			changes[key] = Change{New: value}
+		}
+	}
+
+	for key, change := range changes {
+		if redacted(key, redact) {
+			if change.Old != nil {
+				change.Old = Redacted
+			}
+			if change.New != nil {
+				change.New = Redacted
+			}
+			changes[key] = change
+		}
+	}
+
+	return changes
+}
+
+func fields(model interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if model == nil {
+		return m
+	}
+
+	b, err := json.Marshal(model)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(b, &m)
+	return m
+}
+
+func redacted(key string, redact []string) bool {
+	key = strings.ToLower(key)
+	for _, r := range redact {
+		if strings.Contains(key, strings.ToLower(r)) {
+			return true
+		}
+	}
+	return false
+}
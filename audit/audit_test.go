@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/crud"
+	"github.com/runetid/go-sdk/models"
+	"net/http/httptest"
+	"testing"
+)
+
+type account struct {
+	Id      int    `json:"id"`
+	Role    string `json:"role"`
+	Blocked bool   `json:"blocked"`
+	Secret  string `json:"secret"`
+	Comment string `json:"comment"`
+	EventId int64  `json:"event_id"`
+}
+
+func TestDiff(t *testing.T) {
+	before := account{Id: 1, Role: "user", Secret: "a", Comment: "x"}
+	after := &account{Id: 1, Role: "admin", Blocked: true, Secret: "b", Comment: "x"}
+
+	diff := Diff(before, after, DefaultConfig().Redact)
+	if len(diff) != 3 {
+		t.Fatalf("Unexpected diff %v", diff)
+	}
+	if diff["role"].Old != "user" || diff["role"].New != "admin" || diff["blocked"].New != true {
+		t.Fatalf("Unexpected diff %v", diff)
+	}
+	if diff["secret"].Old != Redacted || diff["secret"].New != Redacted {
+		t.Fatal("Secret not redacted")
+	}
+
+	if diff := Diff(nil, after, nil); len(diff) != 6 || diff["id"].Old != nil {
+		t.Fatalf("Unexpected create diff %v", diff)
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("DELETE", "/apiaccount/1", nil)
+	c.Set("api_key", "key")
+	c.Set("event_id", int64(7))
+	c.Set("traceId", "trace")
+
+	model := &account{Id: 1, Role: "user"}
+	entry := NewEntry(crud.MutationEvent{
+		Action: crud.MutationDelete,
+		Entity: "api_account",
+		Key:    "1",
+		Before: model,
+		Model:  model,
+		Ctx:    c,
+	}, nil)
+
+	if entry.ActorType != ActorAccount || entry.ActorID == "key" || entry.EventID != 7 || entry.TraceID != "trace" || entry.ClientIP != "192.0.2.1" {
+		t.Fatalf("Unexpected entry %+v", entry)
+	}
+	if entry.Diff["role"].Old != "user" || entry.Diff["role"].New != nil {
+		t.Fatalf("Unexpected delete diff %v", entry.Diff)
+	}
+
+	c.Set("api_account_id", int64(3))
+	if actor, id := Actor(c); actor != ActorAccount || id != "3" {
+		t.Fatalf("Expected api account 3, got %s %s", actor, id)
+	}
+
+	c.Set("user", models.User{Id: 42})
+	if actor, id := Actor(c); actor != ActorUser || id != "42" {
+		t.Fatalf("Expected user actor, got %s %s", actor, id)
+	}
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/crud"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Change of a single field, Old is missing for create and New for delete.
+type Change struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// Changes is stored as jsonb.
+type Changes map[string]Change
+
+func (c Changes) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *Changes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	}
+	return errors.New("audit: unsupported diff type")
+}
+
+// Entry is an append-only record of a mutation made through the crud endpoints.
+// The service role should not be able to change the history:
+//
+//	CREATE TABLE audit_log (
+//		id          bigserial PRIMARY KEY,
+//		created_at  timestamptz NOT NULL,
+//		event_id    bigint NOT NULL DEFAULT 0,
+//		action      varchar(16) NOT NULL,
+//		entity      varchar(255) NOT NULL,
+//		entity_id   varchar(255) NOT NULL,
+//		actor_type  varchar(16) NOT NULL,
+//		actor_id    varchar(255) NOT NULL DEFAULT '',
+//		role        varchar(255) NOT NULL DEFAULT '',
+//		trace_id    varchar(64) NOT NULL DEFAULT '',
+//		client_ip   varchar(64) NOT NULL DEFAULT '',
+//		diff        jsonb
+//	);
+//	CREATE INDEX ON audit_log (entity, entity_id);
+//	REVOKE UPDATE, DELETE, TRUNCATE ON audit_log FROM service;
+type Entry struct {
+	ID        int64     `gorm:"primaryKey;column:id" json:"id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	EventID   int64     `gorm:"column:event_id;index" json:"event_id"`
+	Action    string    `gorm:"column:action" json:"action"`
+	Entity    string    `gorm:"column:entity" json:"entity"`
+	EntityID  string    `gorm:"column:entity_id" json:"entity_id"`
+	ActorType string    `gorm:"column:actor_type" json:"actor_type"`
+	ActorID   string    `gorm:"column:actor_id" json:"actor_id"`
+	Role      string    `gorm:"column:role" json:"role"`
+	TraceID   string    `gorm:"column:trace_id" json:"trace_id"`
+	ClientIP  string    `gorm:"column:client_ip" json:"client_ip"`
+	Diff      Changes   `gorm:"column:diff;type:jsonb" json:"diff"`
+}
+
+func (e *Entry) TableName() string {
+	return "audit_log"
+}
+
+func (e *Entry) TenantColumn() string {
+	return "event_id"
+}
+
+func (e *Entry) List(db *gorm.DB, request crud.ListRequest, ctx *context.Context, params ...crud.FilterParams) (interface{}, int64, error) {
+	var models []Entry
+
+	query := db.Model(&Entry{})
+	for _, param := range params {
+		query = query.Where(param.Key+" "+param.Operator+" ?", param.Value)
+	}
+
+	var count int64
+	query.Count(&count)
+
+	err := query.Limit(request.Limit).Offset(request.Offset).Order("id DESC").Find(&models).Error
+	return models, count, err
+}
+
+// GetFilterParams filters by entity, entity_id, action, actor_type and actor_id query parameters.
+func (e *Entry) GetFilterParams(c *gin.Context) []crud.FilterParams {
+	var params []crud.FilterParams
+	for _, key := range []string{"entity", "entity_id", "action", "actor_type", "actor_id"} {
+		if v := c.Query(key); v != "" {
+			params = append(params, crud.FilterParams{Key: key, Operator: "=", Value: v})
+		}
+	}
+	return params
+}
+
+func (e *Entry) Get(db *gorm.DB, key string, ctx *context.Context) (interface{}, error) {
+	var model Entry
+	tx := db.Where("id = ?", key).First(&model)
+	if tx.RowsAffected < 1 {
+		return nil, errors.New("not found")
+	}
+
+	return &model, tx.Error
+}
+
+// AppendEndpoints registers the read-only list and get endpoints, the history has no mutations.
+func AppendEndpoints(app *crud.Application, prefix string, middlewares ...gin.HandlerFunc) {
+	app.AppendListEndpoint(prefix, &Entry{}, middlewares...)
+	app.AppendGetEndpoint(prefix+"/:id", &Entry{}, middlewares...)
+}
@@ -0,0 +1,188 @@
+package authz
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/models"
+	"log"
+	"net/http"
+	"sync"
+)
+
+type Action string
+
+const (
+	List   Action = "list"
+	Get    Action = "get"
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+var CrudActions = []Action{List, Get, Create, Update, Delete}
+
+// Subject holds the attributes put into the gin context by the sdk middlewares.
+type Subject struct {
+	// role of the api account
+	Role    string
+	EventId int64
+	User    *models.User
+	// roles of the verified JWT of the user
+	UserRoles []string
+	TraceId   string
+}
+
+func SubjectFromContext(c *gin.Context) Subject {
+	s := Subject{
+		Role:      c.GetString("role"),
+		EventId:   c.GetInt64("event_id"),
+		UserRoles: c.GetStringSlice("user_roles"),
+		TraceId:   c.GetString("traceId"),
+	}
+
+	switch u := c.Value("user").(type) {
+	case models.User:
+		s.User = &u
+	case *models.User:
+		s.User = u
+	}
+
+	return s
+}
+
+// Condition decides whether the subject may act on the resource. Resource is nil
+// for route level checks, conditions on resource attributes must pass then.
+type Condition func(s Subject, resource interface{}) bool
+
+type rule struct {
+	conditions []Condition
+}
+
+func (r rule) allows(s Subject, resource interface{}) bool {
+	for _, condition := range r.conditions {
+		if !condition(s, resource) {
+			return false
+		}
+	}
+	return true
+}
+
+// Policy is a deny by default set of rules, an action is allowed when all conditions of any of its rules pass.
+type Policy struct {
+	mu     sync.RWMutex
+	rules  map[string][]rule
+	routes map[string][]rule
+}
+
+func NewPolicy() *Policy {
+	return &Policy{
+		rules:  map[string][]rule{},
+		routes: map[string][]rule{},
+	}
+}
+
+func ruleKey(entity string, action Action) string {
+	return entity + ":" + string(action)
+}
+
+// Allow permits the actions on the entity (table name of the crud model) when all conditions pass.
+func (p *Policy) Allow(entity string, actions []Action, conditions ...Condition) *Policy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, action := range actions {
+		key := ruleKey(entity, action)
+		p.rules[key] = append(p.rules[key], rule{conditions: conditions})
+	}
+	return p
+}
+
+// AllowRoute permits a route registered with the router, path is the route template as in c.FullPath().
+func (p *Policy) AllowRoute(method string, path string, conditions ...Condition) *Policy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := method + " " + path
+	p.routes[key] = append(p.routes[key], rule{conditions: conditions})
+	return p
+}
+
+// Can evaluates the rules of the entity action for the subject.
+func (p *Policy) Can(s Subject, entity string, action Action, resource interface{}) bool {
+	p.mu.RLock()
+	rules := p.rules[ruleKey(entity, action)]
+	p.mu.RUnlock()
+
+	return anyAllows(rules, s, resource)
+}
+
+func anyAllows(rules []rule, s Subject, resource interface{}) bool {
+	for _, r := range rules {
+		if r.allows(s, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks the entity action for the subject of the request and logs denials.
+// It implements crud.Authorizer.
+func (p *Policy) Authorize(c *gin.Context, entity string, action string, resource interface{}) bool {
+	s := SubjectFromContext(c)
+	if p.Can(s, entity, Action(action), resource) {
+		return true
+	}
+
+	deny(s, c.Request.Method+" "+c.FullPath(), entity+":"+action)
+	return false
+}
+
+// Require is a middleware checking the entity action on route level.
+func (p *Policy) Require(entity string, action Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !p.Authorize(c, entity, string(action), nil) {
+			forbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Middleware enforces the rules of routes declared with AllowRoute, other routes pass through.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Method + " " + c.FullPath()
+
+		p.mu.RLock()
+		rules, ok := p.routes[key]
+		p.mu.RUnlock()
+
+		if !ok {
+			c.Next()
+			return
+		}
+
+		s := SubjectFromContext(c)
+		if !anyAllows(rules, s, nil) {
+			deny(s, key, "route")
+			forbidden(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func deny(s Subject, route string, permission string) {
+	userId := 0
+	if s.User != nil {
+		userId = s.User.Id
+	}
+
+	log.Printf("authz: denied %s on %s for role %q user %d event %d traceId %s", permission, route, s.Role, userId, s.EventId, s.TraceId)
+}
+
+func forbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"message": "Permission denied"})
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+}
@@ -0,0 +1,94 @@
+package authz
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"testing"
+)
+
+type account struct {
+	EventId int64
+}
+
+func TestPolicy(t *testing.T) {
+	p := NewPolicy().
+		Allow("api_account", CrudActions, Roles("admin")).
+		Allow("api_account", []Action{List, Get}, Roles("manager"), SameEvent(nil))
+
+	admin := Subject{Role: "admin"}
+	manager := Subject{Role: "manager", EventId: 5}
+
+	if !p.Can(admin, "api_account", Delete, account{EventId: 1}) {
+		t.Fatal("Admin denied")
+	}
+
+	if !p.Can(manager, "api_account", List, nil) || !p.Can(manager, "api_account", Get, &account{EventId: 5}) {
+		t.Fatal("Manager denied own event")
+	}
+
+	if p.Can(manager, "api_account", Get, account{EventId: 6}) {
+		t.Fatal("Manager allowed another event")
+	}
+
+	if p.Can(manager, "api_account", Delete, account{EventId: 5}) {
+		t.Fatal("Manager allowed undeclared action")
+	}
+
+	if p.Can(admin, "webhook_subscription", List, nil) {
+		t.Fatal("Undeclared entity allowed")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := NewPolicy().Allow("api_account", []Action{List}, Roles("admin"))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/apiaccount/list", nil)
+	c.Set("role", "manager")
+
+	p.Require("api_account", List)(c)
+
+	if !c.IsAborted() || w.Code != 403 {
+		t.Fatalf("Expected 403, got %d", w.Code)
+	}
+}
+
+func TestUserRolesKeptApart(t *testing.T) {
+	p := NewPolicy().
+		Allow("api_account", []Action{Delete}, Roles("admin")).
+		Allow("api_account", []Action{Get}, UserRoles("admin"))
+	s := Subject{UserRoles: []string{"admin"}}
+
+	if p.Can(s, "api_account", Delete, nil) {
+		t.Fatal("Token role used as api account role")
+	}
+	if !p.Can(s, "api_account", Get, nil) {
+		t.Fatal("Token role denied")
+	}
+}
+
+func TestScopeLists(t *testing.T) {
+	p := NewPolicy().
+		Allow("api_account", []Action{List}, Roles("admin")).
+		Allow("api_account", []Action{List}, Roles("manager"), SameEvent(nil)).
+		Allow("audit_log", []Action{List}, Roles("manager"), Resource(func(s Subject, resource interface{}) bool { return true }))
+
+	q, ok := p.Scope(Subject{Role: "manager", EventId: 5}, "api_account")
+	if !ok || len(q.filters) != 1 {
+		t.Fatal("Manager list not restricted to the event")
+	}
+
+	if q, ok := p.Scope(Subject{Role: "admin", EventId: 5}, "api_account"); !ok || len(q.filters) != 0 {
+		t.Fatal("Admin list restricted")
+	}
+
+	if _, ok := p.Scope(Subject{Role: "manager"}, "api_account"); ok {
+		t.Fatal("List allowed without event")
+	}
+
+	if _, ok := p.Scope(Subject{Role: "manager", EventId: 5}, "audit_log"); ok {
+		t.Fatal("List allowed by a resource check")
+	}
+}
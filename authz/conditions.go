@@ -0,0 +1,120 @@
+package authz
+
+import (
+	"reflect"
+)
+
+// Everyone allows anonymous access.
+func Everyone() Condition {
+	return func(s Subject, resource interface{}) bool {
+		return true
+	}
+}
+
+// Authenticated requires a user resolved by UserMiddleware.
+func Authenticated() Condition {
+	return func(s Subject, resource interface{}) bool {
+		return s.User != nil
+	}
+}
+
+// Roles requires one of the roles of the api account.
+func Roles(roles ...string) Condition {
+	return func(s Subject, resource interface{}) bool {
+		for _, role := range roles {
+			if s.Role == role {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// UserRoles requires one of the roles of the user token verified by UserMiddleware.
+func UserRoles(roles ...string) Condition {
+	return func(s Subject, resource interface{}) bool {
+		for _, role := range roles {
+			for _, userRole := range s.UserRoles {
+				if userRole == role {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// SameEvent allows resources whose event id equals the event of the api account.
+// eventId extracts the id from the resource, nil reads an EventId or EventID field
+// and restricts lists to the event_id column. Lists are denied with a custom eventId.
+func SameEvent(eventId func(resource interface{}) int64) Condition {
+	column := ""
+	if eventId == nil {
+		eventId = EventIdField
+		column = "event_id"
+	}
+
+	return func(s Subject, resource interface{}) bool {
+		if s.EventId == 0 {
+			return false
+		}
+
+		switch r := resource.(type) {
+		case nil:
+			return true
+		case *Query:
+			if column == "" {
+				return false
+			}
+			r.Where(column, s.EventId)
+			return true
+		}
+		return eventId(resource) == s.EventId
+	}
+}
+
+// Resource evaluates a custom check against the loaded resource, it passes on route level
+// and denies lists, which have no single resource to check.
+func Resource(check func(s Subject, resource interface{}) bool) Condition {
+	return func(s Subject, resource interface{}) bool {
+		if _, list := resource.(*Query); list {
+			return false
+		}
+		return resource == nil || check(s, resource)
+	}
+}
+
+func AnyOf(conditions ...Condition) Condition {
+	return func(s Subject, resource interface{}) bool {
+		for _, condition := range conditions {
+			if condition(s, resource) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// EventIdField reads an integer EventId or EventID field of a struct or pointer to struct.
+func EventIdField(resource interface{}) int64 {
+	v := reflect.ValueOf(resource)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+
+	for _, name := range []string{"EventId", "EventID"} {
+		f := v.FieldByName(name)
+		if f.IsValid() && f.CanInt() {
+			return f.Int()
+		}
+	}
+
+	return 0
+}
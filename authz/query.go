@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Query is the resource of list checks, conditions on resource attributes
+// narrow it with filters instead of passing, see Policy.Scope.
+type Query struct {
+	filters []clause.Expression
+}
+
+// Where restricts the listed rows to the column value.
+func (q *Query) Where(column string, value interface{}) {
+	q.filters = append(q.filters, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: value})
+}
+
+// Apply adds the filters to tx.
+func (q *Query) Apply(tx *gorm.DB) *gorm.DB {
+	if len(q.filters) == 0 {
+		return tx
+	}
+	return tx.Where(clause.And(q.filters...)).Session(&gorm.Session{})
+}
+
+// Scope evaluates the list rules of the entity, the filters of the first allowing rule are returned.
+func (p *Policy) Scope(s Subject, entity string) (*Query, bool) {
+	p.mu.RLock()
+	rules := p.rules[ruleKey(entity, List)]
+	p.mu.RUnlock()
+
+	for _, r := range rules {
+		q := &Query{}
+		if r.allows(s, q) {
+			return q, true
+		}
+	}
+	return nil, false
+}
+
+// ListScope checks the list action of the request and returns the filters of the listed rows.
+// It implements crud.ListScoper.
+func (p *Policy) ListScope(c *gin.Context, entity string) (func(tx *gorm.DB) *gorm.DB, bool) {
+	s := SubjectFromContext(c)
+	q, ok := p.Scope(s, entity)
+	if !ok {
+		deny(s, c.Request.Method+" "+c.FullPath(), entity+":"+string(List))
+		return nil, false
+	}
+	return q.Apply, true
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"container/list"
+	"github.com/bradfitz/gomemcache/memcache"
+	"sync"
+	"time"
+)
+
+// Cache stores encoded values with a time to live.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// LRU is an in-process cache evicting the least recently used entries above size.
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func NewLRU(size int) *LRU {
+	if size <= 0 {
+		size = 10000
+	}
+
+	return &LRU{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *LRU) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(ttl)
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*lruEntry).key)
+	}
+}
+
+func (c *LRU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// Memcache stores entries in memcached, usually the CACHE_SRV connection of the application.
+type Memcache struct {
+	client *memcache.Client
+	prefix string
+}
+
+func NewMemcache(client *memcache.Client, prefix string) *Memcache {
+	return &Memcache{client: client, prefix: prefix}
+}
+
+func (c *Memcache) Get(key string) ([]byte, bool) {
+	item, err := c.client.Get(c.prefix + key)
+	if err != nil {
+		return nil, false
+	}
+	return item.Value, true
+}
+
+func (c *Memcache) Set(key string, value []byte, ttl time.Duration) {
+	expiration := int32(ttl / time.Second)
+	if expiration < 1 {
+		expiration = 1
+	}
+
+	c.client.Set(&memcache.Item{Key: c.prefix + key, Value: value, Expiration: expiration})
+}
+
+func (c *Memcache) Delete(key string) {
+	c.client.Delete(c.prefix + key)
+}
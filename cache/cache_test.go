@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Minute)
+	c.Get("a")
+	c.Set("c", []byte("3"), time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("Least recently used entry not evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Recently used entry evicted")
+	}
+
+	c.Set("d", []byte("4"), -time.Second)
+	if _, ok := c.Get("d"); ok {
+		t.Fatal("Expired entry returned")
+	}
+}
+
+func TestLoaderDeduplicatesAndCachesFailures(t *testing.T) {
+	errMissing := errors.New("missing")
+	loader := &Loader[int]{
+		Cache:       NewLRU(10),
+		TTL:         time.Minute,
+		NegativeTTL: time.Minute,
+		Negative:    func(err error) bool { return errors.Is(err, errMissing) },
+		NegativeErr: errMissing,
+	}
+
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loader.Load("key", func() (int, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(20 * time.Millisecond)
+				return 42, nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := loader.Load("key", func() (int, error) { return 0, nil }); v != 42 {
+		t.Fatalf("Expected cached 42, got %d", v)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected a single load, got %d", calls)
+	}
+
+	loader.Load("unknown", func() (int, error) { return 0, errMissing })
+	_, err := loader.Load("unknown", func() (int, error) {
+		t.Fatal("Negative entry not cached")
+		return 0, nil
+	})
+	if !errors.Is(err, errMissing) {
+		t.Fatalf("Expected cached failure, got %v", err)
+	}
+
+	loader.Invalidate("key")
+	if v, _ := loader.Load("key", func() (int, error) { return 1, nil }); v != 1 {
+		t.Fatal("Invalidated entry returned")
+	}
+}
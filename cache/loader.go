@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Group de-duplicates concurrent loads of the same key.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do runs fn once for all concurrent callers with the same key and shares its result.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.val, c.err
+}
+
+// negativeEntry marks a cached lookup failure.
+var negativeEntry = []byte{0}
+
+// ErrCachedFailure is returned for cached failures of loaders without NegativeErr.
+var ErrCachedFailure = errors.New("cache: cached lookup failure")
+
+// Loader caches the results of a remote lookup.
+type Loader[T any] struct {
+	Cache       Cache
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// reports whether the error means the entity does not exist and should be cached,
+	// NegativeErr is returned for cached failures
+	Negative    func(err error) bool
+	NegativeErr error
+
+	group Group
+}
+
+// Load returns the cached value of key or calls fn once for all concurrent callers.
+func (l *Loader[T]) Load(key string, fn func() (T, error)) (T, error) {
+	var model T
+
+	if b, ok := l.Cache.Get(key); ok {
+		if len(b) == 1 && b[0] == negativeEntry[0] {
+			if l.NegativeErr != nil {
+				return model, l.NegativeErr
+			}
+			return model, ErrCachedFailure
+		}
+		if json.Unmarshal(b, &model) == nil {
+			return model, nil
+		}
+	}
+
+	v, err := l.group.Do(key, func() (interface{}, error) {
+		m, err := fn()
+		if err != nil {
+			if l.NegativeTTL > 0 && l.Negative != nil && l.Negative(err) {
+				l.Cache.Set(key, negativeEntry, l.NegativeTTL)
+			}
+			return m, err
+		}
+
+		if b, err := json.Marshal(m); err == nil {
+			l.Cache.Set(key, b, l.TTL)
+		}
+		return m, nil
+	})
+
+	if m, ok := v.(T); ok {
+		model = m
+	}
+	return model, err
+}
+
+// Invalidate removes the cached value of key.
+func (l *Loader[T]) Invalidate(key string) {
+	l.Cache.Delete(key)
+}
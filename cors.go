@@ -0,0 +1,264 @@
+package sdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/cache"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CorsConfig is the cross-origin policy of CorsMiddlewareWithConfig.
+type CorsConfig struct {
+	// exact origins like https://runet-id.com, wildcard subdomains like https://*.runet-id.com or * for any origin
+	AllowOrigins []string
+	// regular expressions matched against the whole origin, they are anchored at both ends
+	AllowOriginPatterns []string
+	// decides on origins not matched above, e.g. by the domains of the api account of the ApiKey header,
+	// it runs before AccountMiddleware and preflights carry no ApiKey
+	AllowOriginFunc func(c *gin.Context, origin string) bool
+	// caches the AllowOriginFunc result per ApiKey header and origin, 0 disables the cache
+	AllowOriginCacheTTL time.Duration
+	AllowMethods        []string
+	// * allows the headers requested by the preflight
+	AllowHeaders  []string
+	ExposeHeaders []string
+	// requires explicit origins, patterns or AllowOriginFunc, see Validate
+	AllowCredentials bool
+	// how long browsers cache the preflight response
+	MaxAge time.Duration
+}
+
+func DefaultCorsConfig() CorsConfig {
+	return CorsConfig{
+		AllowOrigins:        []string{"*"},
+		AllowOriginCacheTTL: time.Minute,
+		AllowMethods:        []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:        []string{"*"},
+		ExposeHeaders:       []string{"X-Trace-Id"},
+		MaxAge:              12 * time.Hour,
+	}
+}
+
+// CorsConfigFromEnv reads CORS_ALLOW_ORIGINS, CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE over the defaults.
+func CorsConfigFromEnv() CorsConfig {
+	config := DefaultCorsConfig()
+
+	if origins := splitList(os.Getenv("CORS_ALLOW_ORIGINS")); len(origins) > 0 {
+		config.AllowOrigins = origins
+	}
+	if b, err := strconv.ParseBool(os.Getenv("CORS_ALLOW_CREDENTIALS")); err == nil {
+		config.AllowCredentials = b
+	}
+	if d, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE")); err == nil {
+		config.MaxAge = d
+	}
+
+	return config
+}
+
+var ErrCorsCredentialsAnyOrigin = errors.New("cors: credentials can not be allowed for any origin, list the origins in CORS_ALLOW_ORIGINS")
+
+// Validate rejects credentials together with the * origin, which would let any site read responses of logged in users.
+func (config CorsConfig) Validate() error {
+	if !config.AllowCredentials {
+		return nil
+	}
+	for _, origin := range config.AllowOrigins {
+		if strings.TrimSpace(origin) == "*" {
+			return ErrCorsCredentialsAnyOrigin
+		}
+	}
+	return nil
+}
+
+type cors struct {
+	config   CorsConfig
+	any      bool
+	exact    map[string]bool
+	suffixes []originSuffix
+	patterns []*regexp.Regexp
+	lookup   *cache.Loader[bool]
+
+	methods string
+	headers string
+	expose  string
+	maxAge  string
+}
+
+// originSuffix is a wildcard subdomain origin, scheme is empty for *.example.com.
+type originSuffix struct {
+	scheme string
+	suffix string
+}
+
+func newCors(config CorsConfig) *cors {
+	if err := config.Validate(); err != nil {
+		log.Println(err.Error() + ", credentials are disabled")
+		config.AllowCredentials = false
+	}
+
+	cr := &cors{
+		config:  config,
+		exact:   map[string]bool{},
+		methods: strings.Join(config.AllowMethods, ", "),
+		headers: strings.Join(config.AllowHeaders, ", "),
+		expose:  strings.Join(config.ExposeHeaders, ", "),
+	}
+
+	for _, origin := range config.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+
+		switch {
+		case origin == "*":
+			cr.any = true
+		case strings.Contains(origin, "*."):
+			scheme, host, found := strings.Cut(origin, "://")
+			if !found {
+				scheme, host = "", origin
+			}
+			cr.suffixes = append(cr.suffixes, originSuffix{scheme: scheme, suffix: strings.TrimPrefix(host, "*")})
+		default:
+			cr.exact[origin] = true
+		}
+	}
+
+	for _, pattern := range config.AllowOriginPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			log.Println("Cors: invalid origin pattern " + pattern)
+			continue
+		}
+		cr.patterns = append(cr.patterns, re)
+	}
+
+	if config.AllowOriginFunc != nil && config.AllowOriginCacheTTL > 0 {
+		cr.lookup = &cache.Loader[bool]{Cache: cache.NewLRU(1000), TTL: config.AllowOriginCacheTTL}
+	}
+
+	if config.MaxAge > 0 {
+		cr.maxAge = strconv.Itoa(int(config.MaxAge / time.Second))
+	}
+
+	return cr
+}
+
+func (cr *cors) allowed(c *gin.Context, origin string) bool {
+	if cr.any {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if cr.exact[origin] {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && u.Host != "" {
+		for _, s := range cr.suffixes {
+			if (s.scheme == "" || s.scheme == u.Scheme) && strings.HasSuffix(u.Host, s.suffix) {
+				return true
+			}
+		}
+	}
+
+	for _, re := range cr.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	if cr.config.AllowOriginFunc == nil {
+		return false
+	}
+	if cr.lookup == nil {
+		return cr.config.AllowOriginFunc(c, origin)
+	}
+
+	// the decision of one account must not be reused for another
+	key := sha256.Sum256([]byte(c.Request.Header.Get("ApiKey")))
+	ok, _ := cr.lookup.Load(hex.EncodeToString(key[:])+" "+origin, func() (bool, error) {
+		return cr.config.AllowOriginFunc(c, origin), nil
+	})
+	return ok
+}
+
+// CorsMiddleware allows every origin without credentials, see CorsMiddlewareWithConfig.
+func CorsMiddleware() func(c *gin.Context) {
+	return CorsMiddlewareWithConfig(DefaultCorsConfig())
+}
+
+// CorsMiddlewareWithConfig answers preflight requests and sets the CORS headers of allowed origins.
+func CorsMiddlewareWithConfig(config CorsConfig) gin.HandlerFunc {
+	cr := newCors(config)
+	config = cr.config
+
+	return func(c *gin.Context) {
+		origin := c.Request.Header.Get("Origin")
+		header := c.Writer.Header()
+		preflight := c.Request.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != ""
+
+		if !cr.any {
+			header.Add("Vary", "Origin")
+			if config.AllowOriginFunc != nil {
+				header.Add("Vary", "ApiKey")
+			}
+		}
+
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		if !cr.allowed(c, origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if cr.any {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if cr.expose != "" {
+				header.Set("Access-Control-Expose-Headers", cr.expose)
+			}
+			c.Next()
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", cr.methods)
+
+		headers := cr.headers
+		if headers == "*" {
+			// the wildcard does not cover Authorization, the requested headers are echoed instead
+			headers = c.Request.Header.Get("Access-Control-Request-Headers")
+		}
+		if headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		}
+		if cr.maxAge != "" {
+			header.Set("Access-Control-Max-Age", cr.maxAge)
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,135 @@
+package sdk
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := DefaultCorsConfig()
+	config.AllowOrigins = []string{"https://runet-id.com", "https://*.runet-id.com"}
+	config.AllowOriginPatterns = []string{`^http://localhost:\d+$`}
+	config.AllowOriginFunc = func(c *gin.Context, origin string) bool {
+		return origin == "https://partner.ru"
+	}
+	config.AllowCredentials = true
+
+	r := gin.New()
+	r.Use(CorsMiddlewareWithConfig(config))
+	r.GET("/event", func(c *gin.Context) {})
+
+	request := func(method string, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/event", nil)
+		req.Header.Set("Origin", origin)
+		if method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "PATCH")
+			req.Header.Set("Access-Control-Request-Headers", "Authorization")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, origin := range []string{"https://runet-id.com", "https://api.runet-id.com", "http://localhost:3000", "https://partner.ru"} {
+		w := request("GET", origin)
+		if w.Header().Get("Access-Control-Allow-Origin") != origin || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Fatalf("Origin %s rejected", origin)
+		}
+		if w.Header().Get("Vary") != "Origin" {
+			t.Fatalf("Missing Vary header for %s", origin)
+		}
+	}
+
+	for _, origin := range []string{"https://evil-runet-id.com", "http://localhost:3000.attacker.com", "https://runet-id.com.attacker.com"} {
+		if w := request("GET", origin); w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("Unknown origin %s allowed", origin)
+		}
+	}
+
+	w := request("OPTIONS", "https://api.runet-id.com")
+	if w.Code != 204 || w.Header().Get("Access-Control-Allow-Headers") != "Authorization" || w.Header().Get("Access-Control-Max-Age") != "43200" {
+		t.Fatalf("Unexpected preflight response %d %v", w.Code, w.Header())
+	}
+
+	if w := request("OPTIONS", "http://evil.com"); w.Code != 403 {
+		t.Fatalf("Expected rejected preflight, got %d", w.Code)
+	}
+}
+
+func TestCorsPatternsAnchored(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := DefaultCorsConfig()
+	config.AllowOrigins = nil
+	config.AllowOriginPatterns = []string{`https://.*\.runet\.id`}
+
+	r := gin.New()
+	r.Use(CorsMiddlewareWithConfig(config))
+	r.GET("/event", func(c *gin.Context) {})
+
+	for origin, allowed := range map[string]bool{"https://api.runet.id": true, "https://evil.runet.id.attacker.com": false} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/event", nil)
+		req.Header.Set("Origin", origin)
+		r.ServeHTTP(w, req)
+
+		if (w.Header().Get("Access-Control-Allow-Origin") == origin) != allowed {
+			t.Fatalf("Origin %s allowed: %v", origin, !allowed)
+		}
+	}
+}
+
+func TestCorsCredentialsAnyOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	config := CorsConfigFromEnv()
+
+	if err := config.Validate(); err != ErrCorsCredentialsAnyOrigin {
+		t.Fatalf("Expected credentials with any origin to be rejected, got %v", err)
+	}
+
+	r := gin.New()
+	r.Use(CorsMiddlewareWithConfig(config))
+	r.GET("/event", func(c *gin.Context) {})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/event", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	r.ServeHTTP(w, req)
+
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("Credentials allowed for any origin: %v", w.Header())
+	}
+}
+
+func TestCorsOriginFuncPerAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := DefaultCorsConfig()
+	config.AllowOrigins = nil
+	config.AllowOriginCacheTTL = time.Minute
+	config.AllowOriginFunc = func(c *gin.Context, origin string) bool {
+		return c.GetHeader("ApiKey") == "partner" && origin == "https://partner.ru"
+	}
+
+	r := gin.New()
+	r.Use(CorsMiddlewareWithConfig(config))
+	r.GET("/event", func(c *gin.Context) {})
+
+	request := func(key string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/event", nil)
+		req.Header.Set("Origin", "https://partner.ru")
+		req.Header.Set("ApiKey", key)
+		r.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	if request("partner") != "https://partner.ru" {
+		t.Fatal("Domain of the account rejected")
+	}
+	if request("other") != "" {
+		t.Fatal("Cached decision of another account reused")
+	}
+}
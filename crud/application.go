@@ -2,47 +2,99 @@ package crud
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	postgres2 "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/github"
 	"github.com/rgglez/gormcache"
 	"github.com/runetid/go-sdk"
+	"github.com/runetid/go-sdk/cache"
+	db2 "github.com/runetid/go-sdk/db"
+	"github.com/runetid/go-sdk/idempotency"
+	"github.com/runetid/go-sdk/jwt"
 	"github.com/runetid/go-sdk/log"
+	"github.com/runetid/go-sdk/metrics"
+	"github.com/runetid/go-sdk/ratelimit"
+	"github.com/runetid/go-sdk/services"
+	"github.com/runetid/go-sdk/trace"
 	"strings"
 
 	//"github.com/runetid/go-sdk/log"
 	"github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"io/fs"
 	log2 "log"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// ShutdownTimeout bounds how long Run waits for running requests after SIGTERM or SIGINT.
+var ShutdownTimeout = 30 * time.Second
+
 type Application struct {
 	Router *gin.Engine
 	Db     *gorm.DB
 	Logger *log.AppLogger
+	// memcached connection on CACHE_SRV, nil when not configured
+	Memcache *memcache.Client
+	// checks access to the crud endpoints appended after it is set, nil allows everything
+	Authorizer Authorizer
+	// roles which see the data of every event of TenantScoped models
+	TenantBypassRoles []string
+	// address of the metrics server, empty serves /metrics on the router
+	MetricsAddr string
+	// read replicas of list and get endpoints, nil reads from Db
+	Replicas *db2.Replicas
+
+	hooks *hookRegistry
 }
 
 type ApplicationConfig struct {
-	PublicRoutes     []string
+	PublicRoutes []string
+	// embed://dir, file://dir or github://owner/repo/dir, a path without scheme
+	// is a directory of DbMigrations or a GitHub path when DbMigrations is nil
 	DbMigrationsPath string
-	DbSchema         string
+	// migrations embedded into the binary, e.g. with //go:embed migrations/*.sql
+	DbMigrations fs.FS
+	DbSchema     string
+	// caches user, api account and event lookups of the middlewares, 0 disables the cache
+	LookupCacheTTL time.Duration
+	// roles which bypass tenant scoping, defaults to admin
+	TenantBypassRoles []string
+	// clients skipping api account authentication, nil reads it from the environment
+	Trust *sdk.TrustConfig
+	// cross-origin policy, nil reads it from the environment
+	Cors *sdk.CorsConfig
+	// limits requests per api key, user or IP, nil disables rate limiting,
+	// counters are shared in memcached when CACHE_SRV is set
+	RateLimit *ratelimit.Config
+	// replays responses of POST and PATCH requests with an Idempotency-Key, nil disables it,
+	// responses are stored in memcached when CACHE_SRV is set and in the idempotency_key table otherwise
+	Idempotency *idempotency.Config
+	// keys of the encrypted serializers, nil reads DB_ENCRYPTION_KEYS
+	Encryption *db2.KeyRing
+	// serves /metrics on a separate address like :9090 instead of the api router, defaults to METRICS_ADDR
+	MetricsAddr string
+	// connection and pool settings, nil reads them from the environment, DbSchema sets the search_path
+	Db *db2.Config
+	// read replicas of list and get endpoints, nil reads DB_REPLICA_HOSTS
+	Replicas []db2.Config
+	// stickiness and health checks of the replicas, nil reads them from the environment
+	ReplicaRouting *db2.ReplicaConfig
 }
 
 func (a Application) Run() {
 	isReady := &atomic.Value{}
 	isReady.Store(false)
-	sdk.AppendMetrics(a.Router)
+	if a.MetricsAddr != "" {
+		go metrics.Serve(a.MetricsAddr)
+	} else {
+		sdk.AppendMetrics(a.Router)
+	}
 
 	a.Router.GET("/healthz", sdk.HealthzWithDb(a.Db))
 	a.Router.GET("/readyz", gin.WrapF(sdk.Readyz(isReady)))
@@ -51,11 +103,45 @@ func (a Application) Run() {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Page not found"})
 	})
 
-	done := make(chan bool)
+	server := &http.Server{Addr: httpAddr(), Handler: a.Router}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+
 	go a.runInternalServer()
-	go a.Router.Run(os.Getenv("HTTP_ADDR"))
+	go func() {
+		log2.Println("Listening and serving HTTP on " + server.Addr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log2.Println("HTTP server stopped: " + err.Error())
+			stop <- syscall.SIGTERM
+		}
+	}()
 	isReady.Store(true)
-	<-done
+	<-stop
+
+	// finish running requests, then flush the queued log messages and spans before exiting
+	isReady.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log2.Println("HTTP server shutdown: " + err.Error())
+	}
+	trace.Shutdown(ctx)
+	if a.Logger != nil {
+		if err := a.Logger.Close(); err != nil {
+			log2.Println("Logger close: " + err.Error())
+		}
+	}
+}
+
+// httpAddr is HTTP_ADDR, else the port gin listens on by default.
+func httpAddr() string {
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		return addr
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
 }
 
 type ModelWithList interface {
@@ -77,6 +163,12 @@ type ModelWithCreate interface {
 	DecodeCreate(c *gin.Context) (interface{}, error)
 }
 
+// ModelWithCreateResponse replaces the created model in the create response,
+// e.g. to return a generated secret once, mutation hooks still receive the model.
+type ModelWithCreateResponse interface {
+	CreateResponse() interface{}
+}
+
 type ModelWithDelete interface {
 	Delete(db *gorm.DB, key string, ctx *context.Context) (bool, error)
 	Get(db *gorm.DB, key string, ctx *context.Context) (interface{}, error)
@@ -107,16 +199,27 @@ func (u BaseCrudModel) DecodeCreate(c *gin.Context) (interface{}, error) {
 func (a Application) AppendListEndpoint(prefix string, entity ModelWithList, middlewares ...gin.HandlerFunc) {
 	a.Router.GET(prefix+"/list", func(c *gin.Context) {
 
-		tx := a.Db.WithContext(c)
+		tx := a.reader(c).WithContext(c)
 
 		for _, middleware := range middlewares {
 			middleware(c)
 		}
 
-		if len(c.Errors) > 0 {
+		if len(c.Errors) > 0 || c.IsAborted() {
 			return
 		}
 
+		tx, ok := a.authorizeList(c, entity, tx)
+		if !ok {
+			return
+		}
+
+		t, ok := a.tenantOf(c, entity)
+		if !ok {
+			return
+		}
+		tx = t.scope(tx)
+
 		var request ListRequest
 		err := c.Bind(&request)
 		if err != nil {
@@ -126,10 +229,10 @@ func (a Application) AppendListEndpoint(prefix string, entity ModelWithList, mid
 			return
 		}
 
-		t, e := c.GetQueryMap("filter")
+		f, e := c.GetQueryMap("filter")
 
 		if e == true {
-			request.Filter = t
+			request.Filter = f
 		}
 
 		s, e := c.GetQueryMap("sort")
@@ -162,7 +265,7 @@ func (a Application) AppendCreateEndpoint(prefix string, entity ModelWithCreate,
 			middleware(c)
 		}
 
-		if len(c.Errors) > 0 {
+		if len(c.Errors) > 0 || c.IsAborted() {
 			return
 		}
 
@@ -172,6 +275,20 @@ func (a Application) AppendCreateEndpoint(prefix string, entity ModelWithCreate,
 			return
 		}
 
+		t, ok := a.tenantOf(c, entity)
+		if !ok {
+			return
+		}
+
+		if err := t.stamp(tx, decode); err != nil {
+			forbiddenTenant(c)
+			return
+		}
+
+		if !a.authorize(c, "create", entity, decode) {
+			return
+		}
+
 		ctx := context.WithoutCancel(c)
 
 		m, err := decode.(ModelWithCreate).Create(tx, &ctx)
@@ -180,6 +297,13 @@ func (a Application) AppendCreateEndpoint(prefix string, entity ModelWithCreate,
 			return
 		}
 
+		a.wrote(c)
+		a.notify(MutationCreate, "", nil, m, c)
+
+		if r, ok := m.(ModelWithCreateResponse); ok {
+			m = r.CreateResponse()
+		}
+
 		c.JSON(http.StatusOK, gin.H{"data": m})
 		return
 	})
@@ -193,7 +317,7 @@ func (a Application) AppendUpdateEndpoint(prefix string, entity ModelWithUpdate,
 			middleware(c)
 		}
 
-		if len(c.Errors) > 0 {
+		if len(c.Errors) > 0 || c.IsAborted() {
 			return
 		}
 
@@ -203,14 +327,49 @@ func (a Application) AppendUpdateEndpoint(prefix string, entity ModelWithUpdate,
 			return
 		}
 
+		t, ok := a.tenantOf(c, entity)
+		if !ok {
+			return
+		}
+
+		if err := t.stamp(tx, decode); err != nil {
+			forbiddenTenant(c)
+			return
+		}
+
+		if found, err := t.exists(tx, decode, c.Param("id")); !found || err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "not found"})
+			return
+		}
+		tx = t.scope(tx)
+
 		ctx := context.WithoutCancel(c)
 
+		// conditions are checked against the stored record, the payload could claim another event
+		var before interface{}
+		resource := decode
+		if getter, ok := entity.(ModelWithGet); ok && (a.Authorizer != nil || a.hasHooks()) {
+			before, err = getter.Get(tx, c.Param("id"), &ctx)
+			if (err != nil || before == nil) && a.Authorizer != nil {
+				c.JSON(http.StatusNotFound, gin.H{"message": "not found"})
+				return
+			}
+			resource = before
+		}
+
+		if !a.authorize(c, "update", entity, resource) {
+			return
+		}
+
 		m, err := decode.(CrudModel).Update(tx, c.Param("id"), &ctx)
 		if err != nil {
 			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
 			return
 		}
 
+		a.wrote(c)
+		a.notify(MutationUpdate, c.Param("id"), before, m, c)
+
 		c.JSON(http.StatusOK, gin.H{"data": m})
 		return
 	})
@@ -223,9 +382,15 @@ func (a Application) AppendDeleteEndpoint(prefix string, entity ModelWithDelete,
 			middleware(c)
 		}
 
-		if len(c.Errors) > 0 {
+		if len(c.Errors) > 0 || c.IsAborted() {
+			return
+		}
+
+		t, ok := a.tenantOf(c, entity)
+		if !ok {
 			return
 		}
+		tx = t.scope(tx)
 
 		ctx := context.WithoutCancel(c)
 
@@ -235,15 +400,22 @@ func (a Application) AppendDeleteEndpoint(prefix string, entity ModelWithDelete,
 			return
 		}
 
+		if !a.authorize(c, "delete", entity, model) {
+			return
+		}
+
 		entity = model.(ModelWithDelete)
 
-		del, err := entity.Delete(a.Db, c.Param("id"), &ctx)
+		del, err := entity.Delete(tx, c.Param("id"), &ctx)
 
 		if !del {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Удаление невозможно " + err.Error()})
 			return
 		}
 
+		a.wrote(c)
+		a.notify(MutationDelete, c.Param("id"), model, model, c)
+
 		c.JSON(http.StatusOK, gin.H{"message": "ok"})
 		return
 	})
@@ -251,14 +423,20 @@ func (a Application) AppendDeleteEndpoint(prefix string, entity ModelWithDelete,
 
 func (a Application) AppendGetEndpoint(prefix string, entity ModelWithGet, middlewares ...gin.HandlerFunc) {
 	a.Router.GET(prefix, func(c *gin.Context) {
-		tx := a.Db.WithContext(c)
+		tx := a.reader(c).WithContext(c)
 		for _, middleware := range middlewares {
 			middleware(c)
 		}
 
-		if len(c.Errors) > 0 {
+		if len(c.Errors) > 0 || c.IsAborted() {
+			return
+		}
+
+		t, ok := a.tenantOf(c, entity)
+		if !ok {
 			return
 		}
+		tx = t.scope(tx)
 
 		ctx := context.WithoutCancel(c)
 
@@ -269,6 +447,10 @@ func (a Application) AppendGetEndpoint(prefix string, entity ModelWithGet, middl
 			return
 		}
 
+		if !a.authorize(c, "get", entity, model) {
+			return
+		}
+
 		c.JSON(200, gin.H{"data": model, "error": err})
 		return
 	})
@@ -278,10 +460,22 @@ func (a Application) AppendSwagger(prefix string) {
 	a.Router.GET(prefix+"/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 }
 
+// AppendLogLevelEndpoint returns the log levels on GET and changes them on PUT,
+// the middlewares must restrict access, e.g. policy.Require("log", authz.Update).
+func (a Application) AppendLogLevelEndpoint(path string, middlewares ...gin.HandlerFunc) {
+	handlers := append(middlewares, log.LevelHandler(a.Logger))
+	a.Router.GET(path, handlers...)
+	a.Router.PUT(path, handlers...)
+}
+
 func (a Application) Schedule(ctx context.Context, p time.Duration, f func(time time.Time)) {
 	go Schedule(ctx, p, f)
 }
 
+func (a Application) ScheduleContext(ctx context.Context, p time.Duration, f func(ctx context.Context, time time.Time)) {
+	go ScheduleContext(ctx, p, f)
+}
+
 func NewCrudApplication(publicRoutes []string) (*Application, error) {
 	return NewCrudApplicationWithConfig(ApplicationConfig{
 		PublicRoutes:     publicRoutes,
@@ -294,66 +488,160 @@ func NewCrudApplicationWithConfig(config ApplicationConfig) (*Application, error
 
 	logger := log.NewAppLogger()
 
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Europe/Moscow",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: log.NewGormLogger(&logger)})
-
 	isTesting := strings.ToUpper(os.Getenv("ENVIRONMENT")) == "TEST"
 
-	if err != nil {
-		if !isTesting {
-			panic("failed to connect database: " + err.Error())
-		}
+	dbConfig := db2.ConfigFromEnv()
+	if config.Db != nil {
+		dbConfig = *config.Db
+	}
+	if config.DbSchema != "" {
+		dbConfig.Schema = config.DbSchema
 	}
+	if isTesting {
+		dbConfig.ConnectAttempts = 1
+	}
+
+	gormLogger := log.NewGormLogger(&logger)
+	plugins := []gorm.Plugin{metrics.GormPlugin{}, gormLogger}
 
+	var mdb *memcache.Client
 	cacheSrv, hasCache := os.LookupEnv("CACHE_SRV")
 	if hasCache {
-		mdb := memcache.New(cacheSrv)
-		cache := gormcache.NewGormCache("my_cache", gormcache.NewMemcacheClient(mdb), gormcache.CacheConfig{
+		mdb = memcache.New(cacheSrv)
+		plugins = append(plugins, gormcache.NewGormCache("my_cache", metrics.NewCacheClient("gorm", gormcache.NewMemcacheClient(mdb)), gormcache.CacheConfig{
 			TTL:    600 * time.Second,
 			Prefix: "cache:",
-		})
+		}))
+	}
+
+	db, err := db2.Open(dbConfig, &gorm.Config{Logger: gormLogger})
 
-		err = db.Use(cache)
-		if err == nil {
-			db.Session(&gorm.Session{Context: context.WithValue(context.Background(), gormcache.UseCacheKey, true)})
+	if err != nil {
+		if !isTesting {
+			return nil, err
 		}
+	} else {
+		usePlugins(db, plugins)
+		if merr := metrics.RegisterDBStats(db, dbConfig.Name); merr != nil {
+			log2.Println(merr)
+		}
+	}
+
+	replicaConfigs := config.Replicas
+	if replicaConfigs == nil {
+		replicaConfigs = db2.ReplicaConfigsFromEnv(dbConfig)
 	}
 
-	if config.DbMigrationsPath != "" {
-		m, merr := migrate.New(
-			fmt.Sprintf("github://%s:%s@%s", os.Getenv("GH_LOGIN"), os.Getenv("GH_TOKEN"), config.DbMigrationsPath),
-			fmt.Sprintf("postgres://%s:%s@%s:%s/%s?search_path=%s&sslmode=disable", os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"), config.DbSchema),
-		)
-
-		if merr == nil {
-			e := m.Up()
-			log2.Println(e)
-		} else {
-			if !errors.Is(merr, postgres2.ErrNoSchema) {
-				log2.Fatal(merr)
+	var replicas *db2.Replicas
+	if len(replicaConfigs) > 0 && db != nil {
+		readers := map[string]*gorm.DB{}
+		for _, rc := range replicaConfigs {
+			name := rc.Host + ":" + rc.Port
+			// unreachable replicas are kept, the health check enables them once they are up
+			replica, rerr := db2.Open(rc, &gorm.Config{Logger: gormLogger})
+			if replica == nil {
+				log2.Println(rerr)
+				continue
+			}
+			if rerr != nil {
+				log2.Println(rerr)
 			}
+			// reads of the replicas are cached and logged like the ones of the primary
+			usePlugins(replica, plugins)
+			readers[name] = replica
+		}
+
+		routing := db2.ReplicaConfigFromEnv()
+		if config.ReplicaRouting != nil {
+			routing = *config.ReplicaRouting
+		}
+		replicas = db2.NewReplicas(db, readers, routing)
+		go replicas.Run(context.Background())
+	}
+
+	if jwtConfig := jwt.ConfigFromEnv(); jwtConfig.Enabled() {
+		verifier, jerr := jwt.NewVerifier(jwtConfig)
+		if jerr != nil {
+			return nil, fmt.Errorf("jwt: %w", jerr)
+		}
+		sdk.TokenVerifier = verifier
+	}
+
+	if config.LookupCacheTTL > 0 {
+		enableLookupCache(mdb, config.LookupCacheTTL)
+	}
+
+	if config.Encryption != nil {
+		db2.Keys = config.Encryption
+	} else if _, ok := os.LookupEnv("DB_ENCRYPTION_KEYS"); ok {
+		keys, err := db2.KeyRingFromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("encryption keys: %w", err)
 		}
+		db2.Keys = keys
 	}
 
+	if config.DbMigrationsPath != "" || config.DbMigrations != nil {
+		source := db2.MigrationSourceURL(config.DbMigrationsPath, config.DbMigrations)
+		report, merr := db2.Migrate(source, config.DbMigrations, dbConfig.URL())
+
+		if merr != nil {
+			if !db2.IsNoSchema(merr) {
+				if report.Dirty {
+					log2.Println("Migrations: " + report.String())
+				}
+				return nil, fmt.Errorf("migrations: %w", merr)
+			}
+			log2.Println("Migrations: skipped, " + merr.Error())
+		}
+	}
+
+	trust := sdk.TrustConfigFromEnv()
+	if config.Trust != nil {
+		trust = *config.Trust
+	}
+
+	cors := sdk.CorsConfigFromEnv()
+	if config.Cors != nil {
+		cors = *config.Cors
+	}
+	if err := cors.Validate(); err != nil {
+		return nil, fmt.Errorf("cors: %w", err)
+	}
+
+	trace.StartFromEnv()
+
 	r := gin.Default()
-	r.Use(func(c *gin.Context) {
-		c.Set("traceId", log.GetTraceId(c))
-	})
+	if err := r.SetTrustedProxies(trust.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	r.Use(trace.Middleware())
+	r.Use(metrics.Middleware())
 	r.Use(log.GinLoggerMiddleware(&logger, log.GinLoggerMiddlewareParams{}))
+	r.Use(sdk.CorsMiddlewareWithConfig(cors))
 	r.Use(sdk.UserMiddleware())
-	r.Use(sdk.TraceMiddleware())
-	r.Use(sdk.CorsMiddleware())
 	r.Use(sdk.JsonMiddleware())
 	r.Use(sdk.DbMiddleware(db))
-	r.Use(sdk.AccountMiddleware(config.PublicRoutes))
+	r.Use(sdk.AccountMiddlewareWithTrust(config.PublicRoutes, trust))
+	// after authentication, so only verified api keys get counters of their own
+	if config.RateLimit != nil {
+		limits := *config.RateLimit
+		if limits.Store == nil && mdb != nil {
+			limits.Store = ratelimit.NewMemcacheStore(mdb)
+		}
+		r.Use(ratelimit.Middleware(limits))
+	}
+	if config.Idempotency != nil {
+		idempotent := *config.Idempotency
+		if idempotent.Store == nil {
+			if mdb != nil {
+				idempotent.Store = idempotency.NewMemcacheStore(mdb)
+			} else {
+				idempotent.Store = idempotency.NewGormStore(db)
+			}
+		}
+		r.Use(idempotency.Middleware(idempotent))
+	}
 
 	//if logger.Inner == false {
 	//	r.Use(gin.LoggerWithConfig(gin.LoggerConfig{
@@ -377,13 +665,51 @@ func NewCrudApplicationWithConfig(config ApplicationConfig) (*Application, error
 	//	r.Use(gin.Recovery())
 	//}
 
+	bypass := config.TenantBypassRoles
+	if bypass == nil {
+		bypass = []string{"admin"}
+	}
+
+	metricsAddr := config.MetricsAddr
+	if metricsAddr == "" {
+		metricsAddr = os.Getenv("METRICS_ADDR")
+	}
+
 	return &Application{
-		Router: r,
-		Db:     db,
-		Logger: &logger,
+		Router:            r,
+		Db:                db,
+		Logger:            &logger,
+		Memcache:          mdb,
+		TenantBypassRoles: bypass,
+		MetricsAddr:       metricsAddr,
+		Replicas:          replicas,
+		hooks:             &hookRegistry{},
 	}, err
 }
 
+func usePlugins(db *gorm.DB, plugins []gorm.Plugin) {
+	for _, plugin := range plugins {
+		if err := db.Use(plugin); err != nil {
+			log2.Println(err)
+		}
+	}
+}
+
+func enableLookupCache(mdb *memcache.Client, ttl time.Duration) {
+	var c cache.Cache = cache.NewLRU(10000)
+	if mdb != nil {
+		c = cache.NewMemcache(mdb, "lookup:")
+	}
+
+	config := services.DefaultCacheConfig()
+	config.TTL = ttl
+	if config.NegativeTTL > ttl {
+		config.NegativeTTL = ttl
+	}
+
+	services.EnableCache(c, config)
+}
+
 type ListRequest struct {
 	Limit  int               `form:"limit" binding:"required,number,min=1,max=100"`
 	Offset int               `form:"offset" binding:"number"`
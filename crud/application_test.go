@@ -0,0 +1,69 @@
+package crud
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type eventModel struct {
+	ID      int   `gorm:"primaryKey;column:id" json:"id"`
+	EventID int64 `gorm:"column:event_id" json:"event_id"`
+
+	BaseCrudModel `gorm:"-" json:"-"`
+}
+
+var updated bool
+
+func (m *eventModel) List(db *gorm.DB, request ListRequest, ctx *context.Context, params ...FilterParams) (interface{}, int64, error) {
+	return nil, 0, nil
+}
+
+func (m *eventModel) DecodeCreate(c *gin.Context) (interface{}, error) {
+	decoded := &eventModel{}
+	return decoded, c.ShouldBindJSON(decoded)
+}
+
+func (m *eventModel) Create(db *gorm.DB, ctx *context.Context) (interface{}, error) {
+	return m, nil
+}
+
+func (m *eventModel) Update(db *gorm.DB, key string, ctx *context.Context) (interface{}, error) {
+	updated = true
+	return m, nil
+}
+
+// Get returns the stored record, which belongs to event 6.
+func (m *eventModel) Get(db *gorm.DB, key string, ctx *context.Context) (interface{}, error) {
+	return &eventModel{ID: 1, EventID: 6}, nil
+}
+
+func (m *eventModel) Delete(db *gorm.DB, key string, ctx *context.Context) (bool, error) {
+	return true, nil
+}
+
+type sameEvent struct{}
+
+func (sameEvent) Authorize(c *gin.Context, entity string, action string, model interface{}) bool {
+	m, ok := model.(*eventModel)
+	return ok && m.EventID == c.GetInt64("event_id")
+}
+
+func TestUpdateAuthorizesStoredRecord(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := Application{Router: gin.New(), Db: dryRunDb(t), Authorizer: sameEvent{}, hooks: &hookRegistry{}}
+	app.AppendUpdateEndpoint("/model/:id", &eventModel{}, func(c *gin.Context) {
+		c.Set("event_id", int64(5))
+	})
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/model/1", strings.NewReader(`{"event_id": 5}`)))
+
+	if w.Code != http.StatusForbidden || updated {
+		t.Fatalf("Record of another event updated with a forged payload, status %d", w.Code)
+	}
+}
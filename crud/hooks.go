@@ -0,0 +1,182 @@
+package crud
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type MutationAction string
+
+const (
+	MutationCreate MutationAction = "create"
+	MutationUpdate MutationAction = "update"
+	MutationDelete MutationAction = "delete"
+)
+
+// MutationEvent describes a change made through one of the Append*Endpoint routes.
+type MutationEvent struct {
+	Action MutationAction
+	Entity string
+	Key    string
+	// state before update and delete, nil for create and for update of models without Get
+	Before interface{}
+	Model  interface{}
+	Ctx    *gin.Context
+}
+
+// MutationHook is called synchronously after a successful create, update or delete.
+type MutationHook func(event MutationEvent)
+
+type hookRegistry struct {
+	mu    sync.RWMutex
+	hooks []MutationHook
+}
+
+// OnMutation registers a hook for every endpoint of the application,
+// including endpoints appended before the hook was registered.
+func (a Application) OnMutation(hook MutationHook) {
+	if a.hooks == nil {
+		panic("crud: application must be created with NewCrudApplicationWithConfig")
+	}
+
+	a.hooks.mu.Lock()
+	defer a.hooks.mu.Unlock()
+	a.hooks.hooks = append(a.hooks.hooks, hook)
+}
+
+// hasHooks tells the endpoints whether loading the state before a mutation is needed.
+func (a Application) hasHooks() bool {
+	if a.hooks == nil {
+		return false
+	}
+
+	a.hooks.mu.RLock()
+	defer a.hooks.mu.RUnlock()
+	return len(a.hooks.hooks) > 0
+}
+
+func (a Application) notify(action MutationAction, key string, before interface{}, model interface{}, c *gin.Context) {
+	if !a.hasHooks() {
+		return
+	}
+
+	a.hooks.mu.RLock()
+	hooks := a.hooks.hooks
+	a.hooks.mu.RUnlock()
+
+	if key == "" {
+		key = primaryKey(a.Db, model)
+	}
+
+	event := MutationEvent{
+		Action: action,
+		Entity: EntityName(model),
+		Key:    key,
+		Before: before,
+		Model:  model,
+		Ctx:    c,
+	}
+
+	for _, hook := range hooks {
+		hook(event)
+	}
+}
+
+// primaryKey returns the primary key of a created model, empty when unknown.
+func primaryKey(db *gorm.DB, model interface{}) string {
+	if db == nil || model == nil {
+		return ""
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return ""
+	}
+
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	value, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(context.Background(), v)
+	if zero {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// EntityName returns the table name of the model, falling back to its type name.
+func EntityName(model interface{}) string {
+	if t, ok := model.(interface{ TableName() string }); ok {
+		return t.TableName()
+	}
+
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	// models returned by value still declare TableName on the pointer receiver
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	if t, ok := p.Interface().(interface{ TableName() string }); ok {
+		return t.TableName()
+	}
+
+	return strings.ToLower(v.Type().Name())
+}
+
+// Authorizer checks access of the request to the endpoints of an entity. Model is nil for list,
+// the decoded model for create and the stored one otherwise. Lists are checked with
+// ListScope when the Authorizer implements ListScoper.
+type Authorizer interface {
+	Authorize(c *gin.Context, entity string, action string, model interface{}) bool
+}
+
+// ListScoper is an Authorizer narrowing lists to the rows the request may see,
+// e.g. authz.Policy restricts them to the event of the api account.
+type ListScoper interface {
+	ListScope(c *gin.Context, entity string) (func(tx *gorm.DB) *gorm.DB, bool)
+}
+
+func (a Application) authorize(c *gin.Context, action string, entity interface{}, model interface{}) bool {
+	if a.Authorizer == nil || a.Authorizer.Authorize(c, EntityName(entity), action, model) {
+		return true
+	}
+
+	forbidden(c)
+	return false
+}
+
+// authorizeList checks the list action and applies the scope of a ListScoper to tx.
+func (a Application) authorizeList(c *gin.Context, entity interface{}, tx *gorm.DB) (*gorm.DB, bool) {
+	scoper, ok := a.Authorizer.(ListScoper)
+	if !ok {
+		return tx, a.authorize(c, "list", entity, nil)
+	}
+
+	scope, allowed := scoper.ListScope(c, EntityName(entity))
+	if !allowed {
+		forbidden(c)
+		return nil, false
+	}
+	return scope(tx), true
+}
+
+func forbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"message": "Permission denied"})
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+}
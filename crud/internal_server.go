@@ -1,14 +1,22 @@
 package crud
 
 import (
-	"fmt"
+	"context"
+	"github.com/runetid/go-sdk/log"
 	"github.com/runetid/go-sdk/models"
+	"github.com/runetid/go-sdk/trace"
+	"github.com/sirupsen/logrus"
 	log2 "log"
 	"net"
 )
 
 func (a Application) runInternalServer() {
-	log2.Println("Listening and serving HTTP on :555")
+	logger := logrus.StandardLogger()
+	if a.Logger != nil {
+		logger = a.Logger.Component(log.ComponentRPC)
+	}
+
+	logger.Info("Listening and serving HTTP on :555")
 	l, err := net.Listen("tcp4", ":555")
 	defer l.Close()
 
@@ -19,10 +27,10 @@ func (a Application) runInternalServer() {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			fmt.Println(err)
+			logger.Error(err)
 			continue
 		}
-		go handleConnection(conn)
+		go handleConnection(conn, logger)
 	}
 }
 
@@ -34,7 +42,7 @@ var internalHandlers = map[string]func(){
 	"test": testHandler,
 }
 
-func handleConnection(conn net.Conn) {
+func handleConnection(conn net.Conn, logger *logrus.Logger) {
 	// Close the connection when we're done
 	defer conn.Close()
 
@@ -42,13 +50,18 @@ func handleConnection(conn net.Conn) {
 	buf := make([]byte, 1024)
 	_, err := conn.Read(buf)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return
 	}
 
+	if req, err := models.DecodeInternalRequest(buf); err == nil {
+		_, span := trace.StartSpan(req.Context(context.Background()), "rpc "+req.Method, trace.KindServer)
+		defer span.Finish()
+	}
+
 	command, err := models.DecodeRequest[string](buf)
 
-	log2.Println("Received: " + command)
+	logger.Debug("Received: " + command)
 
 	_, ok := internalHandlers[command]
 	// If the key exists
@@ -60,11 +73,11 @@ func handleConnection(conn net.Conn) {
 	msg, err := models.DecodeBytes[string](buf)
 
 	if err != nil {
-		log2.Println("Cant decode " + err.Error())
+		logger.Warn("Cant decode " + err.Error())
 	}
 
 	// Print the incoming data
-	fmt.Println("Received: " + msg.Body.(string))
+	logger.Debug("Received: ", msg.Body)
 
 	resp := models.InternalResponse{Body: "Test response"}
 	by, err := models.EncodeBytes(&resp)
@@ -74,7 +87,6 @@ func handleConnection(conn net.Conn) {
 	_, err = conn.Write(by)
 
 	if err != nil {
-		log2.Println("Cant send")
-		log2.Println(err)
+		logger.Error("Cant send: " + err.Error())
 	}
 }
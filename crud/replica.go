@@ -0,0 +1,39 @@
+package crud
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/models"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+// reader returns the connection of list and get endpoints, a replica when configured.
+func (a Application) reader(c *gin.Context) *gorm.DB {
+	if a.Replicas == nil {
+		return a.Db
+	}
+	return a.Replicas.Reader(clientKey(c))
+}
+
+// wrote keeps the reads of the client on the primary for a while after a mutation.
+func (a Application) wrote(c *gin.Context) {
+	a.Replicas.Wrote(clientKey(c))
+}
+
+// clientKey identifies the client for read-your-writes: the user, the api account or the address.
+func clientKey(c *gin.Context) string {
+	if u, ok := c.Get("user"); ok {
+		switch u := u.(type) {
+		case models.User:
+			return "user:" + strconv.Itoa(u.Id)
+		case *models.User:
+			return "user:" + strconv.Itoa(u.Id)
+		}
+	}
+
+	if key := c.GetString("api_key"); key != "" {
+		return "account:" + key
+	}
+
+	return "ip:" + c.ClientIP()
+}
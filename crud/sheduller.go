@@ -2,18 +2,39 @@ package crud
 
 import (
 	"context"
+	"github.com/runetid/go-sdk/trace"
+	"reflect"
+	"runtime"
 	"time"
 )
 
 func Schedule(ctx context.Context, p time.Duration, f func(time time.Time)) {
+	schedule(ctx, p, funcName(f), func(ctx context.Context, t time.Time) {
+		f(t)
+	})
+}
+
+// ScheduleContext runs f with the context of the span of the run, so queries and calls of the job join its trace.
+func ScheduleContext(ctx context.Context, p time.Duration, f func(ctx context.Context, time time.Time)) {
+	schedule(ctx, p, funcName(f), f)
+}
+
+func schedule(ctx context.Context, p time.Duration, name string, f func(ctx context.Context, time time.Time)) {
 	t := time.NewTicker(p)
 	for {
 		select {
 		case v := <-t.C:
-			f(v)
+			// every run is a trace of its own
+			runCtx, span := trace.StartSpan(trace.NewContext(ctx, trace.New()), "schedule "+name, trace.KindInternal)
+			f(runCtx, v)
+			span.Finish()
 		case <-ctx.Done():
 			t.Stop()
 			return
 		}
 	}
 }
+
+func funcName(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
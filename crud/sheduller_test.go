@@ -0,0 +1,28 @@
+package crud
+
+import (
+	"context"
+	"github.com/runetid/go-sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+	"time"
+)
+
+func TestScheduleContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	trace.SetExporter(exporter)
+	defer trace.SetExporter(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ScheduleContext(ctx, time.Millisecond, func(ctx context.Context, _ time.Time) {
+		_, span := trace.StartSpan(ctx, "gorm SELECT", trace.KindClient)
+		span.Finish()
+		cancel()
+	})
+
+	trace.Flush(context.Background())
+	spans := exporter.GetSpans()
+	if len(spans) < 2 || spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Fatalf("Query of the job not a child of its span: %+v", spans)
+	}
+}
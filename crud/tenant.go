@@ -0,0 +1,126 @@
+package crud
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"reflect"
+)
+
+// TenantScoped models are only visible to api accounts of the same event.
+// TenantColumn returns the column holding the event id, usually "event_id".
+type TenantScoped interface {
+	TenantColumn() string
+}
+
+var errCrossTenant = errors.New("cross tenant access")
+
+type tenant struct {
+	column string
+	id     int64
+}
+
+// tenantOf returns the tenant the request is scoped to, nil when the model is not
+// scoped or the role bypasses scoping. Requests without an event are rejected
+// unless they come from an internal client trusted by service token or network.
+func (a Application) tenantOf(c *gin.Context, entity interface{}) (*tenant, bool) {
+	scoped, ok := entity.(TenantScoped)
+	if !ok {
+		return nil, true
+	}
+
+	role := c.GetString("role")
+	for _, r := range a.TenantBypassRoles {
+		if r == role {
+			return nil, true
+		}
+	}
+
+	// only clients authenticated by AccountMiddleware with a service token or a configured network
+	if by := c.GetString("internal_auth"); c.GetBool("internal") && (by == sdk.InternalByServiceToken || by == sdk.InternalByNetwork) {
+		return nil, true
+	}
+
+	id := c.GetInt64("event_id")
+	if id == 0 {
+		forbiddenTenant(c)
+		return nil, false
+	}
+
+	return &tenant{column: scoped.TenantColumn(), id: id}, true
+}
+
+// scope restricts every query built on tx to the tenant.
+func (t *tenant) scope(tx *gorm.DB) *gorm.DB {
+	if t == nil {
+		return tx
+	}
+
+	return tx.Where(clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: t.column},
+		Value:  t.id,
+	}).Session(&gorm.Session{})
+}
+
+// stamp sets the tenant column of a decoded model, a different non zero tenant is rejected.
+func (t *tenant) stamp(db *gorm.DB, model interface{}) error {
+	if t == nil {
+		return nil
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+
+	field := stmt.Schema.LookUpField(t.column)
+	if field == nil {
+		return errors.New("unknown tenant column " + t.column)
+	}
+
+	ctx := context.Background()
+	rv := reflect.ValueOf(model)
+
+	if value, zero := field.ValueOf(ctx, rv); !zero {
+		v := reflect.Indirect(reflect.ValueOf(value))
+		if !v.CanInt() || v.Int() != t.id {
+			return errCrossTenant
+		}
+	}
+
+	return field.Set(ctx, rv, t.id)
+}
+
+// exists checks that the record with the primary key belongs to the tenant.
+func (t *tenant) exists(tx *gorm.DB, model interface{}, key string) (bool, error) {
+	if t == nil {
+		return true, nil
+	}
+
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return false, err
+	}
+
+	if stmt.Schema.PrioritizedPrimaryField == nil {
+		return false, errors.New("model without primary key")
+	}
+
+	var count int64
+	err := t.scope(tx).
+		Model(reflect.New(stmt.Schema.ModelType).Interface()).
+		Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: stmt.Schema.PrioritizedPrimaryField.DBName}, Value: key}).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+func forbiddenTenant(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"message": "Access to another event is denied"})
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+}
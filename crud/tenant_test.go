@@ -0,0 +1,106 @@
+package crud
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type tenantModel struct {
+	ID      int `gorm:"primaryKey;column:id"`
+	EventID int `gorm:"column:event_id"`
+}
+
+func (m *tenantModel) TenantColumn() string {
+	return "event_id"
+}
+
+func dryRunDb(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestTenantStamp(t *testing.T) {
+	db := dryRunDb(t)
+	tn := &tenant{column: "event_id", id: 5}
+
+	m := &tenantModel{}
+	if err := tn.stamp(db, m); err != nil || m.EventID != 5 {
+		t.Fatalf("Tenant not stamped: %v %+v", err, m)
+	}
+
+	if err := tn.stamp(db, &tenantModel{EventID: 6}); err != errCrossTenant {
+		t.Fatalf("Expected cross tenant error, got %v", err)
+	}
+}
+
+func TestTenantScope(t *testing.T) {
+	db := dryRunDb(t)
+	tn := &tenant{column: "event_id", id: 5}
+
+	tx := tn.scope(db)
+	var models []tenantModel
+	tx.Limit(10).Find(&models)
+
+	sql := tx.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&tenantModel{}).Where("id = ?", 1).Find(&models)
+	})
+
+	if !strings.Contains(sql, `"tenant_models"."event_id" = 5`) || strings.Contains(sql, "LIMIT") {
+		t.Fatalf("Unexpected query %s", sql)
+	}
+}
+
+func TestTenantInternalBypass(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := Application{}
+
+	var scoped, allowed bool
+	r := gin.New()
+	r.Use(sdk.AccountMiddlewareWithTrust([]string{"^/event"}, sdk.TrustConfig{Mode: sdk.TrustReport, ServiceTokens: []string{"s3cret"}}))
+	r.GET("/event", func(c *gin.Context) {
+		var tn *tenant
+		tn, allowed = a.tenantOf(c, &tenantModel{})
+		scoped = tn != nil
+	})
+
+	request := func(path string, token string) {
+		allowed = false
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.2:1234"
+		if token != "" {
+			req.Header.Set(sdk.ServiceTokenHeader, token)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// a neighbour in the subnet of the host is not internal
+	request("/event", "")
+	if allowed {
+		t.Fatal("Subnet neighbour bypassed tenant scoping")
+	}
+
+	request("/event", "s3cret")
+	if !allowed || scoped {
+		t.Fatal("Service not allowed to read every tenant")
+	}
+
+	forged := gin.New()
+	forged.GET("/event", func(c *gin.Context) {
+		c.Set("internal", true)
+		_, allowed = a.tenantOf(c, &tenantModel{})
+	})
+	w := httptest.NewRecorder()
+	forged.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/event", nil))
+	if allowed || w.Code != http.StatusForbidden {
+		t.Fatal("Internal flag without trusted authentication bypassed tenant scoping")
+	}
+}
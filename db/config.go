@@ -0,0 +1,251 @@
+package db
+
+import (
+	"fmt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config of the postgres connection and its pool, see ConfigFromEnv.
+type Config struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	// search_path of the connection, empty keeps the server default
+	Schema string
+	// disable, require, verify-ca or verify-full
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+	TimeZone    string
+	// shown in pg_stat_activity, defaults to the service name
+	ApplicationName string
+	// cancels statements running longer, 0 disables the timeout
+	StatementTimeout time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// connection attempts on startup, the pause between them doubles up to ConnectMaxBackoff
+	ConnectAttempts   int
+	ConnectBackoff    time.Duration
+	ConnectMaxBackoff time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Port:              "5432",
+		SSLMode:           "disable",
+		TimeZone:          "Europe/Moscow",
+		ApplicationName:   serviceName(),
+		MaxOpenConns:      20,
+		MaxIdleConns:      10,
+		ConnMaxLifetime:   30 * time.Minute,
+		ConnMaxIdleTime:   5 * time.Minute,
+		ConnectAttempts:   5,
+		ConnectBackoff:    time.Second,
+		ConnectMaxBackoff: 30 * time.Second,
+	}
+}
+
+func serviceName() string {
+	if name := os.Getenv("SERVICE_NAME"); name != "" {
+		return name
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// ConfigFromEnv reads DB_HOST, DB_PORT, DB_USER, DB_PASSWORD, DB_NAME, DB_SCHEMA, DB_SSLMODE,
+// DB_SSLROOTCERT, DB_SSLCERT, DB_SSLKEY, DB_TIMEZONE, DB_APPLICATION_NAME, DB_STATEMENT_TIMEOUT,
+// DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME, DB_CONN_MAX_IDLE_TIME,
+// DB_CONNECT_ATTEMPTS, DB_CONNECT_BACKOFF and DB_CONNECT_MAX_BACKOFF over the defaults.
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+
+	texts := map[string]*string{
+		"DB_HOST":             &config.Host,
+		"DB_PORT":             &config.Port,
+		"DB_USER":             &config.User,
+		"DB_PASSWORD":         &config.Password,
+		"DB_NAME":             &config.Name,
+		"DB_SCHEMA":           &config.Schema,
+		"DB_SSLMODE":          &config.SSLMode,
+		"DB_SSLROOTCERT":      &config.SSLRootCert,
+		"DB_SSLCERT":          &config.SSLCert,
+		"DB_SSLKEY":           &config.SSLKey,
+		"DB_TIMEZONE":         &config.TimeZone,
+		"DB_APPLICATION_NAME": &config.ApplicationName,
+	}
+	for env, field := range texts {
+		if v := os.Getenv(env); v != "" {
+			*field = v
+		}
+	}
+
+	ints := map[string]*int{
+		"DB_MAX_OPEN_CONNS":   &config.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS":   &config.MaxIdleConns,
+		"DB_CONNECT_ATTEMPTS": &config.ConnectAttempts,
+	}
+	for env, field := range ints {
+		if n, err := strconv.Atoi(os.Getenv(env)); err == nil {
+			*field = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"DB_STATEMENT_TIMEOUT":   &config.StatementTimeout,
+		"DB_CONN_MAX_LIFETIME":   &config.ConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME":  &config.ConnMaxIdleTime,
+		"DB_CONNECT_BACKOFF":     &config.ConnectBackoff,
+		"DB_CONNECT_MAX_BACKOFF": &config.ConnectMaxBackoff,
+	}
+	for env, field := range durations {
+		if d, err := time.ParseDuration(os.Getenv(env)); err == nil {
+			*field = d
+		}
+	}
+
+	return config
+}
+
+// DSN returns the key=value connection string of the gorm postgres driver,
+// search_path and statement_timeout are sent as runtime parameters.
+func (c Config) DSN() string {
+	params := [][2]string{
+		{"host", c.Host},
+		{"port", c.Port},
+		{"user", c.User},
+		{"password", c.Password},
+		{"dbname", c.Name},
+		{"sslmode", c.SSLMode},
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+		{"TimeZone", c.TimeZone},
+		{"application_name", c.ApplicationName},
+		{"search_path", c.Schema},
+	}
+	if c.StatementTimeout > 0 {
+		params = append(params, [2]string{"statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)})
+	}
+
+	var parts []string
+	for _, p := range params {
+		if p[1] != "" {
+			parts = append(parts, p[0]+"="+quoteDSN(p[1]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSN quotes values with spaces, quotes or backslashes as libpq expects.
+func quoteDSN(v string) string {
+	if !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// URL returns the postgres:// url of the connection, e.g. for golang-migrate.
+func (c Config) URL() string {
+	query := url.Values{}
+	for k, v := range map[string]string{
+		"sslmode":          c.SSLMode,
+		"sslrootcert":      c.SSLRootCert,
+		"sslcert":          c.SSLCert,
+		"sslkey":           c.SSLKey,
+		"application_name": c.ApplicationName,
+		"search_path":      c.Schema,
+	} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, c.Port),
+		Path:     "/" + c.Name,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// Open connects with ConnectAttempts attempts and exponential backoff and configures the pool.
+// On failure the last *gorm.DB is returned with the error, as gorm.Open does.
+func Open(config Config, gormConfig *gorm.Config) (*gorm.DB, error) {
+	if gormConfig == nil {
+		gormConfig = &gorm.Config{}
+	}
+
+	attempts := config.ConnectAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := config.ConnectBackoff
+
+	var db *gorm.DB
+	var err error
+	for attempt := 1; ; attempt++ {
+		db, err = connect(config, gormConfig)
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= attempts {
+			return db, fmt.Errorf("connect to database %s on %s: %w", config.Name, config.Host, err)
+		}
+		closeDB(db)
+
+		log.Printf("Database: attempt %d of %d failed, retrying in %s: %s", attempt, attempts, backoff, err)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if config.ConnectMaxBackoff > 0 && backoff > config.ConnectMaxBackoff {
+			backoff = config.ConnectMaxBackoff
+		}
+	}
+}
+
+func connect(config Config, gormConfig *gorm.Config) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(config.DSN()), gormConfig)
+	if err != nil {
+		return db, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return db, err
+	}
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
+	return db, nil
+}
+
+func closeDB(db *gorm.DB) {
+	if db == nil {
+		return
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
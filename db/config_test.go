@@ -0,0 +1,60 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("DB_HOST", "pg")
+	t.Setenv("DB_USER", "events")
+	t.Setenv("DB_PASSWORD", "it's secret")
+	t.Setenv("DB_NAME", "events")
+	t.Setenv("DB_SSLMODE", "verify-full")
+	t.Setenv("DB_SSLROOTCERT", "/etc/ssl/pg.crt")
+	t.Setenv("DB_STATEMENT_TIMEOUT", "5s")
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("DB_APPLICATION_NAME", "events")
+	t.Setenv("DB_CONNECT_MAX_BACKOFF", "10s")
+
+	config := ConfigFromEnv()
+	config.Schema = "tenant"
+
+	if config.MaxOpenConns != 50 || config.StatementTimeout != 5*time.Second || config.TimeZone != "Europe/Moscow" ||
+		config.ConnectMaxBackoff != 10*time.Second {
+		t.Fatalf("config = %+v", config)
+	}
+
+	dsn := config.DSN()
+	for _, part := range []string{
+		"host=pg", "port=5432", `password='it\'s secret'`, "sslmode=verify-full", "sslrootcert=/etc/ssl/pg.crt",
+		"application_name=events", "search_path=tenant", "statement_timeout=5000", "TimeZone=Europe/Moscow",
+	} {
+		if !strings.Contains(dsn, part) {
+			t.Fatalf("%s missing in %s", part, dsn)
+		}
+	}
+
+	url := config.URL()
+	if !strings.HasPrefix(url, "postgres://events:it%27s%20secret@pg:5432/events?") ||
+		!strings.Contains(url, "search_path=tenant") || !strings.Contains(url, "sslmode=verify-full") {
+		t.Fatalf("url = %s", url)
+	}
+}
+
+func TestOpenRetries(t *testing.T) {
+	config := DefaultConfig()
+	config.Host = "127.0.0.1"
+	config.Port = "1"
+	config.ConnectAttempts = 2
+	config.ConnectBackoff = time.Millisecond
+
+	start := time.Now()
+	if _, err := Open(config, nil); err == nil {
+		t.Fatal("connected to a closed port")
+	}
+	if time.Since(start) < time.Millisecond {
+		t.Fatal("no backoff between attempts")
+	}
+}
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gorm.io/gorm/schema"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNoKeys     = errors.New("db: encryption keys are not configured")
+	ErrUnknownKey = errors.New("db: unknown encryption key")
+	ErrMalformed  = errors.New("db: malformed ciphertext")
+)
+
+const (
+	prefixRandom        = "enc:v1:"
+	prefixDeterministic = "enc:d1:"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+	schema.RegisterSerializer("encrypted_deterministic", EncryptedSerializer{Deterministic: true})
+}
+
+// KeyRing holds AES keys by id, new values are encrypted with the primary key
+// and the id is stored with the ciphertext so old keys keep decrypting after a rotation.
+type KeyRing struct {
+	primary string
+	keys    map[string]cipher.AEAD
+	macs    map[string][]byte
+}
+
+// NewKeyRing accepts 16, 24 or 32 byte keys for AES-128, AES-192 or AES-256.
+func NewKeyRing(primary string, keys map[string][]byte) (*KeyRing, error) {
+	k := &KeyRing{primary: primary, keys: map[string]cipher.AEAD{}, macs: map[string][]byte{}}
+
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("db: invalid encryption key id %q", id)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("db: encryption key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("deterministic nonce"))
+
+		k.keys[id] = aead
+		k.macs[id] = mac.Sum(nil)
+	}
+
+	if _, ok := k.keys[primary]; !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return k, nil
+}
+
+// KeyRingFromEnv reads DB_ENCRYPTION_KEYS as comma separated id:base64 pairs,
+// DB_ENCRYPTION_KEY_ID selects the primary key and defaults to the first one.
+func KeyRingFromEnv() (*KeyRing, error) {
+	list := os.Getenv("DB_ENCRYPTION_KEYS")
+	if list == "" {
+		return nil, ErrNoKeys
+	}
+
+	keys := map[string][]byte{}
+	primary := os.Getenv("DB_ENCRYPTION_KEY_ID")
+
+	for _, pair := range strings.Split(list, ",") {
+		id, encoded, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found {
+			return nil, fmt.Errorf("db: invalid encryption key %q, expected id:base64", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("db: encryption key %s: %w", id, err)
+		}
+
+		keys[id] = key
+		if primary == "" {
+			primary = id
+		}
+	}
+
+	return NewKeyRing(primary, keys)
+}
+
+// Keys is used by the encrypted serializers, it is read from the environment on first use when nil.
+var Keys *KeyRing
+
+var envKeys struct {
+	once sync.Once
+	keys *KeyRing
+	err  error
+}
+
+func keyRing() (*KeyRing, error) {
+	if Keys != nil {
+		return Keys, nil
+	}
+
+	envKeys.once.Do(func() {
+		envKeys.keys, envKeys.err = KeyRingFromEnv()
+	})
+	return envKeys.keys, envKeys.err
+}
+
+// Encrypt seals the value with the primary key and a random nonce.
+func (k *KeyRing) Encrypt(plain []byte) (string, error) {
+	nonce := make([]byte, k.keys[k.primary].NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return k.seal(prefixRandom, nonce, plain), nil
+}
+
+// EncryptDeterministic returns the same ciphertext for the same value and primary key,
+// which allows equality lookups at the cost of revealing equal values.
+func (k *KeyRing) EncryptDeterministic(plain []byte) string {
+	mac := hmac.New(sha256.New, k.macs[k.primary])
+	mac.Write(plain)
+	nonce := mac.Sum(nil)[:k.keys[k.primary].NonceSize()]
+	return k.seal(prefixDeterministic, nonce, plain)
+}
+
+func (k *KeyRing) seal(prefix string, nonce []byte, plain []byte) string {
+	sealed := k.keys[k.primary].Seal(nonce, nonce, plain, nil)
+	return prefix + k.primary + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+func (k *KeyRing) Decrypt(ciphertext string) ([]byte, error) {
+	var rest string
+	switch {
+	case strings.HasPrefix(ciphertext, prefixRandom):
+		rest = ciphertext[len(prefixRandom):]
+	case strings.HasPrefix(ciphertext, prefixDeterministic):
+		rest = ciphertext[len(prefixDeterministic):]
+	default:
+		return nil, ErrMalformed
+	}
+
+	id, encoded, found := strings.Cut(rest, ":")
+	if !found {
+		return nil, ErrMalformed
+	}
+
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// Encrypted reports whether the stored value is a ciphertext, plain values are read as is
+// so existing rows keep working until they are saved again.
+func Encrypted(value string) bool {
+	return strings.HasPrefix(value, prefixRandom) || strings.HasPrefix(value, prefixDeterministic)
+}
+
+// Lookup returns the value of an encrypted_deterministic column for queries,
+// e.g. db.Where("secret = ?", db.Lookup(secret)). Rows encrypted with a previous primary key do not match.
+func Lookup(plain string) (string, error) {
+	k, err := keyRing()
+	if err != nil {
+		return "", err
+	}
+	return k.EncryptDeterministic([]byte(plain)), nil
+}
+
+// EncryptedSerializer encrypts string and []byte fields:
+//
+//	Secret db.Secret `gorm:"column:secret;serializer:encrypted" json:"secret"`
+//	Email  string    `gorm:"column:email;serializer:encrypted_deterministic" json:"email"`
+type EncryptedSerializer struct {
+	Deterministic bool
+}
+
+func (s EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("db: unsupported encrypted value %T of %s", dbValue, field.Name)
+	}
+
+	plain := []byte(value)
+	if Encrypted(value) {
+		k, err := keyRing()
+		if err != nil {
+			return err
+		}
+		if plain, err = k.Decrypt(value); err != nil {
+			return fmt.Errorf("db: decrypt %s: %w", field.Name, err)
+		}
+	}
+
+	fieldValue := reflect.New(field.FieldType).Elem()
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(string(plain))
+	case reflect.Slice:
+		fieldValue.SetBytes(plain)
+	default:
+		return fmt.Errorf("db: encrypted field %s must be a string or []byte", field.Name)
+	}
+
+	field.ReflectValueOf(ctx, dst).Set(fieldValue)
+	return nil
+}
+
+func (s EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var plain []byte
+	v := reflect.ValueOf(fieldValue)
+	switch {
+	case v.Kind() == reflect.String:
+		plain = []byte(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		plain = v.Bytes()
+	default:
+		return nil, fmt.Errorf("db: encrypted field %s must be a string or []byte", field.Name)
+	}
+
+	// empty values stay empty to keep NOT NULL defaults and emptiness checks working
+	if len(plain) == 0 {
+		return "", nil
+	}
+
+	k, err := keyRing()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Deterministic {
+		return k.EncryptDeterministic(plain), nil
+	}
+	return k.Encrypt(plain)
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type account struct {
+	Id     int
+	Secret Secret `gorm:"serializer:encrypted"`
+	Email  string `gorm:"serializer:encrypted_deterministic"`
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, _ := NewKeyRing("1", map[string][]byte{"1": []byte(strings.Repeat("a", 32))})
+	ring, _ := NewKeyRing("2", map[string][]byte{"1": []byte(strings.Repeat("a", 32)), "2": []byte(strings.Repeat("b", 32))})
+
+	ciphertext, err := old.Encrypt([]byte("secret"))
+	if err != nil || !strings.HasPrefix(ciphertext, "enc:v1:1:") {
+		t.Fatalf("Unexpected ciphertext %s %v", ciphertext, err)
+	}
+
+	if plain, err := ring.Decrypt(ciphertext); err != nil || string(plain) != "secret" {
+		t.Fatalf("Old key not usable after rotation: %s %v", plain, err)
+	}
+
+	if a, b := ring.EncryptDeterministic([]byte("x")), ring.EncryptDeterministic([]byte("x")); a != b || !strings.HasPrefix(a, "enc:d1:2:") {
+		t.Fatalf("Expected equal deterministic ciphertexts, got %s %s", a, b)
+	}
+
+	tampered := ciphertext[:len(ciphertext)-2] + "AA"
+	if _, err := ring.Decrypt(tampered); err == nil {
+		t.Fatal("Tampered ciphertext decrypted")
+	}
+}
+
+func TestSerializer(t *testing.T) {
+	Keys, _ = NewKeyRing("1", map[string][]byte{"1": []byte(strings.Repeat("a", 32))})
+	defer func() { Keys = nil }()
+
+	s, err := schema.Parse(&account{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	field := s.LookUpField("secret")
+	model := &account{Secret: "s3cret"}
+
+	value, err := field.Serializer.Value(ctx, field, reflect.ValueOf(model).Elem(), model.Secret)
+	if err != nil || !Encrypted(value.(string)) {
+		t.Fatalf("Expected encrypted value, got %v %v", value, err)
+	}
+
+	loaded := &account{}
+	if err := field.Serializer.Scan(ctx, field, reflect.ValueOf(loaded).Elem(), value); err != nil || loaded.Secret != "s3cret" {
+		t.Fatalf("Unexpected decrypted value %q %v", loaded.Secret, err)
+	}
+
+	// rows written before encryption are read as is
+	field.Serializer.Scan(ctx, field, reflect.ValueOf(loaded).Elem(), []byte("plain"))
+	if loaded.Secret != "plain" {
+		t.Fatalf("Unexpected legacy value %q", loaded.Secret)
+	}
+
+	email := s.LookUpField("email")
+	value, _ = email.Serializer.Value(ctx, email, reflect.ValueOf(model).Elem(), "a@b.c")
+	if lookup, _ := Lookup("a@b.c"); lookup != value {
+		t.Fatal("Lookup does not match the stored value")
+	}
+
+	if b, _ := json.Marshal(loaded); !strings.Contains(string(b), `"Secret":null`) {
+		t.Fatalf("Secret rendered: %s", b)
+	}
+}
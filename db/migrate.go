@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "github.com/golang-migrate/migrate/v4/source/github"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+)
+
+var ErrDirty = errors.New("migrations: database is dirty")
+
+// MigrationReport describes the schema version before and after Migrate.
+type MigrationReport struct {
+	From  uint
+	To    uint
+	Dirty bool
+}
+
+func (r MigrationReport) String() string {
+	switch {
+	case r.Dirty:
+		return fmt.Sprintf("database is dirty at version %d, fix the failed migration and run migrate force", r.To)
+	case r.From == r.To:
+		return fmt.Sprintf("up to date at version %d", r.To)
+	}
+	return fmt.Sprintf("migrated from version %d to %d", r.From, r.To)
+}
+
+// MigrationSourceURL selects the source by scheme: embed://dir reads dir of fsys, file://dir a local
+// directory and github://owner/repo/dir GitHub. Paths without scheme are read from fsys when it is set
+// and from GitHub with GH_LOGIN and GH_TOKEN otherwise.
+func MigrationSourceURL(path string, fsys fs.FS) string {
+	if strings.Contains(path, "://") {
+		return path
+	}
+	if fsys != nil {
+		return "embed://" + path
+	}
+	return fmt.Sprintf("github://%s:%s@%s", os.Getenv("GH_LOGIN"), os.Getenv("GH_TOKEN"), path)
+}
+
+// Migrate applies the pending migrations of the source to the database url, see MigrationSourceURL.
+// No pending migrations is a success, a dirty database is reported with ErrDirty.
+func Migrate(sourceURL string, fsys fs.FS, databaseURL string) (MigrationReport, error) {
+	var report MigrationReport
+
+	m, err := newMigrate(sourceURL, fsys, databaseURL)
+	if err != nil {
+		return report, err
+	}
+	defer m.Close()
+
+	report.From, report.Dirty, err = version(m)
+	report.To = report.From
+	if err != nil {
+		return report, err
+	}
+	if report.Dirty {
+		return report, fmt.Errorf("%w at version %d", ErrDirty, report.From)
+	}
+
+	upErr := m.Up()
+	if errors.Is(upErr, migrate.ErrNoChange) {
+		upErr = nil
+	}
+
+	report.To, report.Dirty, err = version(m)
+	if upErr != nil {
+		return report, upErr
+	}
+	if err != nil {
+		return report, err
+	}
+
+	log.Println("Migrations: " + report.String())
+	return report, nil
+}
+
+func newMigrate(sourceURL string, fsys fs.FS, databaseURL string) (*migrate.Migrate, error) {
+	dir, embedded := strings.CutPrefix(sourceURL, "embed://")
+	if !embedded {
+		return migrate.New(sourceURL, databaseURL)
+	}
+
+	if fsys == nil {
+		return nil, fmt.Errorf("migrations: %s needs a file system", sourceURL)
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	source, err := iofs.New(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithSourceInstance("iofs", source, databaseURL)
+}
+
+func version(m *migrate.Migrate) (uint, bool, error) {
+	v, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return v, dirty, err
+}
+
+// IsNoSchema reports the missing schema of the search_path, which the applications skip migrations for.
+func IsNoSchema(err error) bool {
+	return errors.Is(err, postgres.ErrNoSchema)
+}
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaConfig of the read routing, see NewReplicas.
+type ReplicaConfig struct {
+	// reads of a client within this window after its write go to the primary
+	StickyWindow time.Duration
+	// pause between health checks of the replicas
+	HealthInterval time.Duration
+	// replicas lagging behind the primary by more are not used, 0 disables the check
+	MaxLag time.Duration
+}
+
+func DefaultReplicaConfig() ReplicaConfig {
+	return ReplicaConfig{
+		StickyWindow:   5 * time.Second,
+		HealthInterval: 5 * time.Second,
+		MaxLag:         30 * time.Second,
+	}
+}
+
+// ReplicaConfigFromEnv reads DB_REPLICA_STICKY_WINDOW, DB_REPLICA_HEALTH_INTERVAL and DB_REPLICA_MAX_LAG over the defaults.
+func ReplicaConfigFromEnv() ReplicaConfig {
+	config := DefaultReplicaConfig()
+
+	durations := map[string]*time.Duration{
+		"DB_REPLICA_STICKY_WINDOW":   &config.StickyWindow,
+		"DB_REPLICA_HEALTH_INTERVAL": &config.HealthInterval,
+		"DB_REPLICA_MAX_LAG":         &config.MaxLag,
+	}
+	for env, field := range durations {
+		if d, err := time.ParseDuration(os.Getenv(env)); err == nil {
+			*field = d
+		}
+	}
+
+	return config
+}
+
+// ReplicaConfigsFromEnv returns a connection config per host of DB_REPLICA_HOSTS (host or host:port,
+// comma separated), the other settings are taken from the primary.
+func ReplicaConfigsFromEnv(primary Config) []Config {
+	var configs []Config
+	for _, host := range strings.Split(os.Getenv("DB_REPLICA_HOSTS"), ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+
+		config := primary
+		config.Host = host
+		if h, port, found := strings.Cut(host, ":"); found {
+			config.Host, config.Port = h, port
+		}
+		// a replica being down must not block the startup, the health check picks it up later
+		config.ConnectAttempts = 1
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+type replica struct {
+	db      *gorm.DB
+	name    string
+	healthy atomic.Bool
+}
+
+// Replicas routes reads to healthy replicas in turn and falls back to the primary.
+type Replicas struct {
+	config   ReplicaConfig
+	primary  *gorm.DB
+	replicas []*replica
+	next     atomic.Uint64
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+}
+
+// NewReplicas routes reads to the replicas, they are considered unhealthy until the first health check.
+func NewReplicas(primary *gorm.DB, replicas map[string]*gorm.DB, config ReplicaConfig) *Replicas {
+	r := &Replicas{
+		config:  config,
+		primary: primary,
+		writes:  map[string]time.Time{},
+	}
+	for name, db := range replicas {
+		r.replicas = append(r.replicas, &replica{db: db, name: name})
+	}
+	return r
+}
+
+// Reader returns a healthy replica unless the client identified by key wrote within the sticky window.
+func (r *Replicas) Reader(key string) *gorm.DB {
+	if r == nil {
+		return nil
+	}
+	if key != "" && r.sticky(key) {
+		return r.primary
+	}
+
+	n := len(r.replicas)
+	start := int(r.next.Add(1))
+	for i := 0; i < n; i++ {
+		rep := r.replicas[(start+i)%n]
+		if rep.healthy.Load() {
+			return rep.db
+		}
+	}
+	return r.primary
+}
+
+// Wrote sends the reads of the client to the primary for the sticky window,
+// so it sees its own writes before they reach the replicas.
+func (r *Replicas) Wrote(key string) {
+	if r == nil || key == "" || r.config.StickyWindow <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes[key] = time.Now().Add(r.config.StickyWindow)
+}
+
+func (r *Replicas) sticky(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.writes[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(r.writes, key)
+		return false
+	}
+	return true
+}
+
+// Healthy returns the names of the replicas used for reads.
+func (r *Replicas) Healthy() []string {
+	var names []string
+	for _, rep := range r.replicas {
+		if rep.healthy.Load() {
+			names = append(names, rep.name)
+		}
+	}
+	return names
+}
+
+// Run checks the replicas every HealthInterval until the context is done.
+func (r *Replicas) Run(ctx context.Context) {
+	interval := r.config.HealthInterval
+	if interval <= 0 {
+		interval = DefaultReplicaConfig().HealthInterval
+	}
+
+	r.Check(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Check(ctx)
+			r.expireWrites()
+		}
+	}
+}
+
+// Check pings every replica and compares its replay lag with MaxLag, nodes not replaying
+// the WAL of the primary are unhealthy.
+func (r *Replicas) Check(ctx context.Context) {
+	for _, rep := range r.replicas {
+		err := r.check(ctx, rep.db)
+		healthy := err == nil
+
+		if rep.healthy.Swap(healthy) != healthy {
+			if healthy {
+				log.Println("Database: replica " + rep.name + " is healthy")
+			} else {
+				log.Println("Database: replica " + rep.name + " is unhealthy, reads fall back: " + err.Error())
+			}
+		}
+	}
+}
+
+var errNotReplaying = errors.New("not replaying the WAL of the primary")
+
+type lagError time.Duration
+
+func (e lagError) Error() string {
+	return "replication lag " + time.Duration(e).String()
+}
+
+func (r *Replicas) check(ctx context.Context, db *gorm.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+	if r.config.MaxLag <= 0 {
+		return nil
+	}
+
+	// the replica is current when it replayed everything the primary wrote, also while its
+	// WAL receiver is disconnected from an idle primary, otherwise the age of the last
+	// replayed transaction is its lag
+	primary, err := r.primary.DB()
+	if err != nil {
+		return err
+	}
+	var position string
+	if err := primary.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&position); err != nil {
+		return err
+	}
+
+	// null on a primary or before the first replayed transaction
+	var current *bool
+	var lag *float64
+	err = sqlDB.QueryRowContext(ctx, `SELECT pg_last_wal_replay_lsn() >= $1::pg_lsn,
+		EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())`, position).Scan(&current, &lag)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errNotReplaying
+	}
+	if *current {
+		return nil
+	}
+	if lag == nil {
+		return errNotReplaying
+	}
+	if time.Duration(*lag*float64(time.Second)) > r.config.MaxLag {
+		return lagError(time.Duration(*lag * float64(time.Second)))
+	}
+	return nil
+}
+
+func (r *Replicas) expireWrites() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, until := range r.writes {
+		if now.After(until) {
+			delete(r.writes, key)
+		}
+	}
+}
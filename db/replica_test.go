@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func openDryRun(t *testing.T, dsn string) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: dsn}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestReplicasRouting(t *testing.T) {
+	primary := openDryRun(t, "host=primary")
+	one, two := openDryRun(t, "host=one"), openDryRun(t, "host=two")
+
+	r := NewReplicas(primary, map[string]*gorm.DB{"one": one, "two": two}, ReplicaConfig{StickyWindow: 50 * time.Millisecond})
+	if r.Reader("user:1") != primary {
+		t.Fatal("unchecked replicas used")
+	}
+
+	for _, rep := range r.replicas {
+		rep.healthy.Store(true)
+	}
+	seen := map[*gorm.DB]bool{}
+	for i := 0; i < 4; i++ {
+		seen[r.Reader("user:1")] = true
+	}
+	if !seen[one] || !seen[two] || seen[primary] {
+		t.Fatal("reads not spread over the replicas")
+	}
+
+	r.Wrote("user:1")
+	if r.Reader("user:1") != primary {
+		t.Fatal("read after write not sent to the primary")
+	}
+	if r.Reader("user:2") == primary {
+		t.Fatal("other client sent to the primary")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if r.Reader("user:1") == primary {
+		t.Fatal("client stuck to the primary after the window")
+	}
+}
+
+func TestReplicasHealthCheck(t *testing.T) {
+	config := DefaultConfig()
+	config.Host = "127.0.0.1"
+	config.Port = "1"
+	config.ConnectAttempts = 1
+	down, _ := Open(config, &gorm.Config{DisableAutomaticPing: true})
+
+	primary := openDryRun(t, "host=primary")
+	r := NewReplicas(primary, map[string]*gorm.DB{"down": down}, DefaultReplicaConfig())
+	r.replicas[0].healthy.Store(true)
+
+	r.Check(context.Background())
+	if len(r.Healthy()) != 0 || r.Reader("") != primary {
+		t.Fatal("unreachable replica used")
+	}
+}
+
+func TestReplicaConfigsFromEnv(t *testing.T) {
+	t.Setenv("DB_REPLICA_HOSTS", "replica-1, replica-2:5433")
+
+	primary := DefaultConfig()
+	primary.Name = "events"
+	configs := ReplicaConfigsFromEnv(primary)
+	if len(configs) != 2 || configs[0].Host != "replica-1" || configs[0].Port != "5432" ||
+		configs[1].Port != "5433" || configs[1].Name != "events" || configs[1].ConnectAttempts != 1 {
+		t.Fatalf("configs = %+v", configs)
+	}
+}
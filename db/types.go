@@ -116,3 +116,11 @@ func (v *JsonNullInt32) UnmarshalJSON(data []byte) error {
 	}
 	return nil
 }
+
+// Secret is accepted in request bodies but always rendered as null,
+// so list and get endpoints never return it.
+type Secret string
+
+func (v Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(nil)
+}
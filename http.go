@@ -1,39 +1,23 @@
 package sdk
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"github.com/runetid/go-sdk/models"
+	"github.com/runetid/go-sdk/httpclient"
+	"github.com/runetid/go-sdk/jwt"
+	"github.com/runetid/go-sdk/services"
+	"github.com/runetid/go-sdk/trace"
 	"gorm.io/gorm"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"os"
 	"regexp"
-	"strconv"
 	"strings"
 )
 
-func CorsMiddleware() func(c *gin.Context) {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	}
-}
-
 func JsonMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json")
@@ -52,23 +36,23 @@ func intersect(n1, n2 *net.IPNet) bool {
 	return n2.Contains(n1.IP) || n1.Contains(n2.IP)
 }
 
+// AccountMiddleware authenticates api accounts, trust is configured from the environment (see TrustConfigFromEnv).
 func AccountMiddleware(whiteList []string) gin.HandlerFunc {
+	return AccountMiddlewareWithTrust(whiteList, TrustConfigFromEnv())
+}
+
+func AccountMiddlewareWithTrust(whiteList []string, config TrustConfig) gin.HandlerFunc {
 
 	wl := append([]string{"/metrics", "/healthz", "/readyz"}, whiteList...)
+	t := newTrust(config)
 
 	return func(c *gin.Context) {
 
-		addrs, err := net.InterfaceAddrs()
-		_, remoteCIDR, err := net.ParseCIDR(c.ClientIP() + "/24")
-		if err == nil {
-
-			for _, a := range addrs {
-				_, localCIDR, pe := net.ParseCIDR(a.String() + "/24")
-				if pe == nil && intersect(localCIDR, remoteCIDR) {
-					c.Next()
-					return
-				}
-			}
+		if by := t.allow(c); by != "" {
+			c.Set("internal", true)
+			c.Set("internal_auth", by)
+			c.Next()
+			return
 		}
 
 		for _, s := range wl {
@@ -78,65 +62,37 @@ func AccountMiddleware(whiteList []string) gin.HandlerFunc {
 			}
 		}
 
-		doNext := true
-
-		key := c.Request.Header.Get("ApiKey")
-		hash := c.Request.Header.Get("Hash")
-		time := c.Request.Header.Get("Time")
-
-		req, err := http.NewRequest(http.MethodGet, os.Getenv("DNS_ACCOUNT")+"/apiaccount/check", nil)
-
-		if err != nil {
-			log.Println(err.Error() + " " + c.Request.Header.Get("referer"))
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Cant check account"})
-			c.Writer.WriteHeaderNow()
-			c.Abort()
-			doNext = false
-			return
-		}
-
-		q := req.URL.Query()
-		q.Add("ApiKey", key)
-		q.Add("Hash", hash)
-		q.Add("Time", time)
-		q.Add("Origin", c.Request.Header.Get("Origin"))
-		req.URL.RawQuery = q.Encode()
-
-		res, err := http.DefaultClient.Do(req)
+		response, err := services.Accounts.Check(c, services.AccountCheck{
+			ApiKey: c.Request.Header.Get("ApiKey"),
+			Hash:   c.Request.Header.Get("Hash"),
+			Time:   c.Request.Header.Get("Time"),
+			Origin: c.Request.Header.Get("Origin"),
+		})
 
 		if err != nil {
 			log.Println(err.Error() + " " + c.Request.Header.Get("referer"))
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Cant check api account"})
-			c.Writer.WriteHeaderNow()
-			c.Abort()
-			doNext = false
-			return
-		}
-
-		if res.StatusCode != http.StatusOK {
-			c.JSON(http.StatusUnauthorized, res.Body)
+			if errors.Is(err, services.ErrUnauthorized) {
+				c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+			} else {
+				c.JSON(http.StatusUnauthorized, gin.H{"message": "Cant check api account"})
+			}
 			c.Writer.WriteHeaderNow()
 			c.Abort()
-			doNext = false
 			return
 		}
 
-		defer res.Body.Close()
-		body, err := io.ReadAll(res.Body)
-		var response models.ApiAccountResponse
-		if err := json.Unmarshal(body, &response); err != nil { // Parse []byte to go struct pointer
-			log.Println("Can not unmarshal api account response " + string(body))
-		} else {
-			c.Set("event_id", response.Data.EventId)
-			c.Set("role", response.Data.Role)
+		c.Set("event_id", response.Data.EventId)
+		if response.Data.Id != 0 {
+			c.Set("api_account_id", response.Data.Id)
 		}
+		c.Set("role", response.Data.Role)
+		c.Set("api_key", c.Request.Header.Get("ApiKey"))
 
-		if doNext {
-			c.Next()
-		}
+		c.Next()
 	}
 }
 
+// Deprecated: declare permissions with authz.Policy.
 func AdminOnlyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exist := c.Get("role")
@@ -151,6 +107,7 @@ func AdminOnlyMiddleware() gin.HandlerFunc {
 	}
 }
 
+// Deprecated: declare permissions with authz.Policy, roles are evaluated locally.
 func RbacMiddleware(role string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -178,21 +135,33 @@ func RbacMiddleware(role string) gin.HandlerFunc {
 
 		token := strings.TrimSpace(splitToken[1])
 
-		req, err := http.NewRequest(http.MethodGet, os.Getenv("DNS_USERS")+"/user/can/"+token+"/"+role, nil)
+		if TokenVerifier != nil && jwt.LooksLikeJWT(token) {
+			claims, err := TokenVerifier.Verify(c, token)
+			if err != nil || !claims.HasRole(role) {
+				log.Println("RBAC permission denied for jwt " + c.Request.Header.Get("referer"))
+				c.JSON(http.StatusUnauthorized, gin.H{"message": "Permission denied"})
+				c.Writer.WriteHeaderNow()
+				c.Abort()
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		can, err := services.Users.Can(c, token, role)
 
 		if err != nil {
-			log.Println("RBAC Missed cant create request to user microservice " + c.Request.Header.Get("referer"))
+			log.Println("RBAC cant fetch user microservice " + err.Error() + " " + c.Request.Header.Get("referer"))
 			c.JSON(http.StatusUnauthorized, gin.H{"message": "Cant check user permissions"})
 			c.Writer.WriteHeaderNow()
 			c.Abort()
 			return
 		}
 
-		res, err := http.DefaultClient.Do(req)
-
-		if res.StatusCode != http.StatusOK {
-			log.Println("RBAC Missed cant fetch user microservice " + c.Request.Header.Get("referer"))
-			c.JSON(http.StatusUnauthorized, res.Body)
+		if !can {
+			log.Println("RBAC permission denied " + c.Request.Header.Get("referer"))
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Permission denied"})
 			c.Writer.WriteHeaderNow()
 			c.Abort()
 			return
@@ -202,15 +171,15 @@ func RbacMiddleware(role string) gin.HandlerFunc {
 	}
 }
 
+// TraceMiddleware keeps the trace id of the caller, see trace.Middleware.
 func TraceMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		u := uuid.New().String()
-		c.Set("traceId", u)
-
-		c.Next()
-	}
+	return trace.Middleware()
 }
 
+// TokenVerifier validates JWT bearer tokens locally in UserMiddleware and RbacMiddleware,
+// opaque tokens are still resolved by the users service. Nil disables local verification.
+var TokenVerifier *jwt.Verifier
+
 func UserMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -224,10 +193,22 @@ func UserMiddleware() gin.HandlerFunc {
 			if token != "" {
 				c.Set("token", token)
 
-				u, err := RawFetchModel(http.MethodGet, os.Getenv("DNS_USER")+"/internal/byToken/"+token, nil, c.Value("traceId").(string), models.User{})
-
-				if err == nil {
-					c.Set("user", u)
+				if TokenVerifier != nil && jwt.LooksLikeJWT(token) {
+					claims, err := TokenVerifier.Verify(c, token)
+
+					if err == nil {
+						c.Set("user", claims.User())
+						// kept apart from the role of the api account, which drives tenant bypass and authz.Roles
+						c.Set("user_roles", claims.Roles())
+					} else {
+						log.Println("User middleware: " + err.Error())
+					}
+				} else {
+					u, err := services.Users.ByToken(c, token)
+
+					if err == nil {
+						c.Set("user", u)
+					}
 				}
 			}
 		}
@@ -240,10 +221,10 @@ func EventMiddle(c *gin.Context) {
 	key := c.Request.Header.Get("ApiKey")
 
 	if key != "" {
-		ars, err := RawFetchModel[models.ApiAccountResponse](http.MethodGet, os.Getenv("DNS_ACCOUNT")+"/apiaccount/check/"+key, nil, c.Value("traceId").(string), models.ApiAccountResponse{})
+		ars, err := services.Accounts.ByKey(c, key)
 		if err == nil {
-			event, err := RawFetchModel[models.Event](http.MethodGet, os.Getenv("DNS_EVENT")+"/event/"+strconv.FormatInt(ars.Data.EventId, 10), nil, c.Value("traceId").(string), models.Event{})
-			if err != nil {
+			event, err := services.Events.Get(c, ars.Data.EventId)
+			if err == nil {
 				c.Set("event", event)
 			}
 		}
@@ -252,47 +233,28 @@ func EventMiddle(c *gin.Context) {
 	c.Next()
 }
 
+// RawFetchModel fetches the {"data": ...} envelope of an internal service.
+// Upstream errors are returned as *httpclient.Error, errors.Is(err, httpclient.ErrNotFound) holds for 404.
 func RawFetchModel[T any](method string, url string, body io.Reader, traceId string, model T) (T, error) {
-	resp, err := RawFetch(method, url, body, traceId)
-	if err == nil {
-
-		D := struct {
-			Data T `json:"data"`
-		}{}
-
-		b, _ := io.ReadAll(resp.Body)
-		err = json.Unmarshal(b, &D)
-		if err == nil {
-			return D.Data, nil
-		}
+	m, err := httpclient.Fetch[T](context.Background(), httpclient.Default, method, url, body, traceHeader(traceId))
+	if err != nil {
+		return model, err
 	}
 
-	err = errors.New("not found")
-
-	return model, err
+	return m, nil
 }
 
+// RawFetch sends the request through the shared client, the caller closes the response body.
 func RawFetch(method string, url string, body io.Reader, traceId string) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, body)
-	req.Header.Set("X-Trace-Id", traceId)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	return resp, nil
+	return httpclient.Default.Do(context.Background(), method, url, body, traceHeader(traceId))
 }
-func FetchInternal(url string, traceId string) (interface{}, error) {
-	client := http.Client{}
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Trace-Id", traceId)
 
-	resp, err := client.Do(req)
+func FetchInternal(url string, traceId string) (interface{}, error) {
+	resp, err := RawFetch(http.MethodGet, url, nil, traceId)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	b, err := httputil.DumpResponse(resp, true)
 	if err != nil {
@@ -302,6 +264,12 @@ func FetchInternal(url string, traceId string) (interface{}, error) {
 	return string(b), nil
 }
 
+func traceHeader(traceId string) http.Header {
+	header := http.Header{}
+	header.Set("X-Trace-Id", traceId)
+	return header
+}
+
 type ErrorMessage struct {
 	Message string `json:"message" example:"Модель не найдена"`
 }
@@ -0,0 +1,347 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/runetid/go-sdk/trace"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// service name used in errors and metrics
+	Name    string
+	BaseURL string
+	Timeout time.Duration
+	// retries of idempotent requests after the first attempt
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// consecutive failures of a host which open its circuit breaker, 0 disables it
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// called for every outgoing request before it is sent
+	RequestHooks []func(req *http.Request)
+}
+
+func DefaultConfig(name string, baseURL string) Config {
+	return Config{
+		Name:             name,
+		BaseURL:          baseURL,
+		Timeout:          10 * time.Second,
+		MaxRetries:       2,
+		InitialBackoff:   100 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		BreakerThreshold: 10,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// maxBreakers bounds the hosts tracked by a client, closed breakers are dropped beyond it.
+const maxBreakers = 1000
+
+type Client struct {
+	config Config
+	http   *http.Client
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func New(config Config) *Client {
+	if config.Name == "" {
+		config.Name = "default"
+	}
+
+	return &Client{
+		config:   config,
+		http:     &http.Client{Timeout: config.Timeout},
+		breakers: map[string]*breaker{},
+	}
+}
+
+// breaker returns the circuit breaker of the host, so a failing host
+// does not block the others reached through the same client, e.g. Default.
+func (c *Client) breaker(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if b, ok := c.breakers[host]; ok {
+		return b
+	}
+
+	if len(c.breakers) >= maxBreakers {
+		for h, b := range c.breakers {
+			if b.closed() {
+				delete(c.breakers, h)
+			}
+		}
+	}
+
+	b := newBreaker(c.config.BreakerThreshold, c.config.BreakerCooldown)
+	c.breakers[host] = b
+	return b
+}
+
+func (c *Client) Name() string {
+	return c.config.Name
+}
+
+func (c *Client) BaseURL() string {
+	return c.config.BaseURL
+}
+
+// AddRequestHook registers a hook applied to every request sent by the client.
+func (c *Client) AddRequestHook(hook func(req *http.Request)) {
+	c.config.RequestHooks = append(c.config.RequestHooks, hook)
+}
+
+var (
+	servicesMu sync.Mutex
+	services   = map[string]*Client{}
+)
+
+// Service returns the shared client of a microservice. Unless registered with
+// Register its base url is read from the DNS_<NAME> environment variable.
+func Service(name string) *Client {
+	servicesMu.Lock()
+	defer servicesMu.Unlock()
+
+	if c, ok := services[name]; ok {
+		return c
+	}
+
+	c := New(DefaultConfig(name, os.Getenv("DNS_"+strings.ToUpper(name))))
+	services[name] = c
+	return c
+}
+
+// Register replaces the shared client of a microservice.
+func Register(c *Client) {
+	servicesMu.Lock()
+	defer servicesMu.Unlock()
+
+	services[c.config.Name] = c
+}
+
+// Default is used for absolute urls which do not belong to a registered service.
+var Default = New(DefaultConfig("default", ""))
+
+func (c *Client) url(path string) string {
+	if c.config.BaseURL == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return strings.TrimRight(c.config.BaseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// Do sends the request and returns the response for any status code, the caller closes the body.
+// Idempotent requests are retried with exponential backoff on network errors, 429 and 5xx.
+func (c *Client) Do(ctx context.Context, method string, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = b
+	}
+
+	attempts := 1
+	if idempotent(method) {
+		attempts += c.config.MaxRetries
+	}
+
+	backoff := c.config.InitialBackoff
+	var lastErr error
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			retriesTotal.WithLabelValues(c.config.Name).Inc()
+
+			if err := sleep(ctx, jitter(backoff)); err != nil {
+				return nil, err
+			}
+
+			backoff *= 2
+			if c.config.MaxBackoff > 0 && backoff > c.config.MaxBackoff {
+				backoff = c.config.MaxBackoff
+			}
+		}
+
+		res, err := c.send(ctx, method, path, payload, header)
+		if err == nil && !retryable(res.StatusCode) {
+			return res, nil
+		}
+
+		if err != nil {
+			lastErr = err
+			if errors.Is(err, ErrCircuitOpen) || ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if attempt == attempts-1 {
+			return res, nil
+		}
+
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+
+	return nil, lastErr
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, payload []byte, header http.Header) (*http.Response, error) {
+	target := c.url(path)
+
+	var host string
+	if u, err := url.Parse(target); err == nil {
+		host = u.Host
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	ctx, span := trace.StartSpan(ctx, "HTTP "+method, trace.KindClient)
+	defer span.Finish()
+	span.SetAttribute("peer.service", c.config.Name)
+	span.SetAttribute("http.method", method)
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttribute("http.url", req.URL.Redacted())
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	trace.Inject(req)
+
+	for _, hook := range c.config.RequestHooks {
+		hook(req)
+	}
+
+	// the request is built before a probe is let through, so nothing but its outcome releases the probe
+	breaker := c.breaker(host)
+	if !breaker.allow() {
+		circuitOpenTotal.WithLabelValues(c.config.Name).Inc()
+		err = fmt.Errorf("%s %s: %w", c.config.Name, host, ErrCircuitOpen)
+		span.SetError(err)
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := c.http.Do(req)
+	requestDuration.WithLabelValues(c.config.Name, method).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		requestsTotal.WithLabelValues(c.config.Name, method, "error").Inc()
+		if ctx.Err() != nil {
+			// the caller gave up, which says nothing about the host
+			breaker.release()
+		} else {
+			breaker.failure()
+		}
+		span.SetError(err)
+		return nil, err
+	}
+
+	requestsTotal.WithLabelValues(c.config.Name, method, strconv.Itoa(res.StatusCode)).Inc()
+	span.SetAttribute("http.status_code", res.StatusCode)
+
+	if res.StatusCode >= 500 {
+		breaker.failure()
+		span.SetError(errors.New(res.Status))
+	} else {
+		breaker.success()
+	}
+
+	return res, nil
+}
+
+// Fetch sends the request and decodes the {"data": ...} envelope used by our services.
+// Non 2xx responses are returned as *Error with the upstream body.
+func Fetch[T any](ctx context.Context, c *Client, method string, path string, body io.Reader, header http.Header) (T, error) {
+	envelope, err := FetchJSON[struct {
+		Data T `json:"data"`
+	}](ctx, c, method, path, body, header)
+
+	return envelope.Data, err
+}
+
+// FetchJSON is like Fetch but decodes the whole response body into T.
+func FetchJSON[T any](ctx context.Context, c *Client, method string, path string, body io.Reader, header http.Header) (T, error) {
+	var model T
+
+	res, err := c.Do(ctx, method, path, body, header)
+	if err != nil {
+		return model, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return model, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return model, &Error{
+			Service:    c.config.Name,
+			Method:     method,
+			Url:        res.Request.URL.String(),
+			StatusCode: res.StatusCode,
+			Body:       b,
+		}
+	}
+
+	if err := json.Unmarshal(b, &model); err != nil {
+		return model, fmt.Errorf("%s %s: decode response: %w", c.config.Name, method, err)
+	}
+
+	return model, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
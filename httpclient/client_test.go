@@ -0,0 +1,138 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchRetriesIdempotentRequests(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"data": {"id": 42}}`))
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig("test", srv.URL)
+	config.InitialBackoff = time.Millisecond
+	c := New(config)
+
+	model, err := Fetch[struct {
+		Id int `json:"id"`
+	}](context.Background(), c, http.MethodGet, "/model/42", nil, nil)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if model.Id != 42 || calls != 3 {
+		t.Fatalf("Expected id 42 after 3 calls, got %d after %d", model.Id, calls)
+	}
+}
+
+func TestFetchReturnsTypedError(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "missing"}`))
+	}))
+	defer srv.Close()
+
+	c := New(DefaultConfig("test", srv.URL))
+
+	_, err := Fetch[int](context.Background(), c, http.MethodPost, "/model", nil, nil)
+
+	if !errors.Is(err, ErrNotFound) || StatusCode(err) != http.StatusNotFound {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Non idempotent request sent %d times", calls)
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig("test", srv.URL)
+	config.MaxRetries = 0
+	config.BreakerThreshold = 2
+	c := New(config)
+
+	for i := 0; i < 2; i++ {
+		res, err := c.Do(context.Background(), http.MethodGet, "/", nil, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	if _, err := c.Do(context.Background(), http.MethodGet, "/", nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected open circuit, got %v", err)
+	}
+}
+
+func TestCircuitBreakerPerHost(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	config := DefaultConfig("default", "")
+	config.MaxRetries = 0
+	config.BreakerThreshold = 1
+	c := New(config)
+
+	res, err := c.Do(context.Background(), http.MethodGet, failing.URL, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	if _, err := c.Do(context.Background(), http.MethodGet, failing.URL, nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected open circuit, got %v", err)
+	}
+	res, err = c.Do(context.Background(), http.MethodGet, healthy.URL, nil, nil)
+	if err != nil {
+		t.Fatalf("Failing host blocked another one: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestCircuitBreakerIgnoresCancelledRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("slow") {
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig("test", srv.URL)
+	config.MaxRetries = 0
+	config.BreakerThreshold = 1
+	c := New(config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Do(ctx, http.MethodGet, "/?slow", nil, nil); err == nil {
+		t.Fatal("Expected deadline error")
+	}
+
+	res, err := c.Do(context.Background(), http.MethodGet, "/", nil, nil)
+	if err != nil {
+		t.Fatalf("Cancelled request opened the circuit: %v", err)
+	}
+	res.Body.Close()
+}
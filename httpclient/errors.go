@@ -0,0 +1,43 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// Error is returned for upstream responses with a non 2xx status code.
+type Error struct {
+	Service    string
+	Method     string
+	Url        string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *Error) Error() string {
+	body := string(e.Body)
+	if len(body) > 512 {
+		body = body[:512] + "..."
+	}
+	return fmt.Sprintf("%s %s %s: status %d: %s", e.Service, e.Method, e.Url, e.StatusCode, body)
+}
+
+// Is makes errors.Is(err, ErrNotFound) true for 404 responses.
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// StatusCode returns the upstream status code of err or 0 if err is not an upstream error.
+func StatusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package httpclient
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sdk_http_client_requests_total",
+		Help: "Outgoing HTTP requests by service, method and status code.",
+	}, []string{"service", "method", "code"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sdk_http_client_request_duration_seconds",
+		Help:    "Outgoing HTTP request latency by service and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "method"})
+
+	retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sdk_http_client_retries_total",
+		Help: "Retried outgoing HTTP requests by service.",
+	}, []string{"service"})
+
+	circuitOpenTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sdk_http_client_circuit_open_total",
+		Help: "Requests rejected by an open circuit breaker by service.",
+	}, []string{"service"})
+)
@@ -0,0 +1,133 @@
+package idempotency
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	created := 0
+
+	r := gin.New()
+	// the api key verified by AccountMiddleware
+	r.Use(func(c *gin.Context) {
+		c.Set("api_key", c.Request.Header.Get("ApiKey"))
+	})
+	r.Use(Middleware(DefaultConfig()))
+	r.POST("/apiaccount", func(c *gin.Context) {
+		created++
+		c.JSON(http.StatusCreated, gin.H{"id": created})
+	})
+
+	request := func(apiKey string, key string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/apiaccount", strings.NewReader(body))
+		req.Header.Set("ApiKey", apiKey)
+		req.Header.Set(Header, key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := request("a", "1", `{"role":"admin"}`)
+	retry := request("a", "1", `{"role":"admin"}`)
+	if created != 1 || retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Fatalf("Expected replayed response, got %d %s, created %d", retry.Code, retry.Body.String(), created)
+	}
+	if retry.Header().Get(ReplayedHeader) != "true" {
+		t.Fatal("Missing replay header")
+	}
+
+	if w := request("a", "1", `{"role":"user"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected payload mismatch, got %d", w.Code)
+	}
+
+	if request("b", "1", `{"role":"admin"}`); created != 2 {
+		t.Fatal("Key shared between api keys")
+	}
+	if request("a", "", `{"role":"admin"}`); created != 3 {
+		t.Fatal("Request without key replayed")
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxBodySize = 8
+
+	r := gin.New()
+	r.Use(Middleware(config))
+	r.POST("/apiaccount", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	request := func(body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/apiaccount", strings.NewReader(body))
+		req.Header.Set(Header, body)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request("{}"); code != http.StatusCreated {
+		t.Fatalf("Small body rejected with %d", code)
+	}
+	if code := request(`{"role":"admin"}`); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413, got %d", code)
+	}
+}
+
+func TestFailedAndInProgress(t *testing.T) {
+	store := NewMemoryStore()
+	config := DefaultConfig()
+	config.Store = store
+
+	calls := 0
+	r := gin.New()
+	r.Use(Middleware(config))
+	r.POST("/apiaccount", func(c *gin.Context) {
+		calls++
+		// a retry while the first request still runs
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/apiaccount", strings.NewReader("{}"))
+		req.Header.Set(Header, c.Request.Header.Get(Header))
+		if calls == 1 {
+			r.ServeHTTP(w, req)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"nested": w.Code})
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/apiaccount", strings.NewReader("{}"))
+	req.Header.Set(Header, "1")
+	r.ServeHTTP(w, req)
+
+	if w.Code != 500 || !strings.Contains(w.Body.String(), "409") {
+		t.Fatalf("Expected concurrent retry to conflict, got %d %s", w.Code, w.Body.String())
+	}
+	if len(store.records) != 0 {
+		t.Fatal("Failed request kept its key")
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	store.records["old"] = Record{Key: "old", ExpiresAt: time.Now().Add(-time.Second)}
+	store.records["other"] = Record{Key: "other", ExpiresAt: time.Now().Add(-time.Second)}
+
+	if r, _ := store.Begin(Record{Key: "old", ExpiresAt: time.Now().Add(time.Hour)}); r != nil {
+		t.Fatal("Expired record returned")
+	}
+	if _, ok := store.records["other"]; !ok {
+		t.Fatal("Records swept on every request")
+	}
+
+	store.sweptAt = time.Now().Add(-2 * sweepInterval)
+	store.Begin(Record{Key: "new", ExpiresAt: time.Now().Add(time.Hour)})
+	if _, ok := store.records["other"]; ok {
+		t.Fatal("Expired record kept after the sweep interval")
+	}
+}
@@ -0,0 +1,178 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/ratelimit"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+type Config struct {
+	Store Store
+	// how long responses are replayed
+	TTL time.Duration
+	// how long a request without a response blocks its key, e.g. after a crash
+	LockTimeout time.Duration
+	// methods using the header, defaults to POST and PATCH
+	Methods []string
+	// separates the keys of clients, defaults to the api key, then the user, then the client IP
+	Scope func(c *gin.Context) string
+	// largest request body in bytes which is read to hash the payload, larger ones fail with 413
+	MaxBodySize int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Store:       NewMemoryStore(),
+		TTL:         24 * time.Hour,
+		LockTimeout: time.Minute,
+		Methods:     []string{http.MethodPost, http.MethodPatch},
+		Scope:       DefaultScope,
+		MaxBodySize: 1 << 20,
+	}
+}
+
+// DefaultScope scopes keys by the verified api key, the authenticated user or the client IP
+// like the rate limiter, AccountMiddleware has to run before. Api keys are hashed.
+var DefaultScope = ratelimit.First(ratelimit.ByApiKey, ratelimit.ByUser, ratelimit.ByIP)
+
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// Middleware replays the stored response of requests repeating an Idempotency-Key.
+// Reusing a key with another payload fails with 422, a retry of a running request with 409.
+func Middleware(config Config) gin.HandlerFunc {
+	defaults := DefaultConfig()
+	if config.Store == nil {
+		config.Store = defaults.Store
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaults.TTL
+	}
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = defaults.LockTimeout
+	}
+	if config.Methods == nil {
+		config.Methods = defaults.Methods
+	}
+	if config.Scope == nil {
+		config.Scope = defaults.Scope
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = defaults.MaxBodySize
+	}
+
+	methods := map[string]bool{}
+	for _, m := range config.Methods {
+		methods[m] = true
+	}
+
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get(Header)
+		if key == "" || !methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+
+		if len(key) > 255 {
+			abort(c, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abort(c, http.StatusRequestEntityTooLarge, "Request body is too large")
+				return
+			}
+			abort(c, http.StatusBadRequest, "Can not read request body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		id := sha256.Sum256([]byte(config.Scope(c) + "\n" + key))
+		hash := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.RequestURI()+"\n"), body...))
+
+		now := time.Now()
+		record := Record{
+			Key:         hex.EncodeToString(id[:]),
+			RequestHash: hex.EncodeToString(hash[:]),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(config.LockTimeout),
+		}
+
+		existing, err := config.Store.Begin(record)
+		if err != nil {
+			// an unavailable store must not take the service down
+			log.Println("Idempotency: " + err.Error() + " traceId " + c.GetString("traceId"))
+			c.Next()
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.RequestHash != record.RequestHash:
+				abort(c, http.StatusUnprocessableEntity, "Idempotency-Key is used with another request")
+			case !existing.Completed:
+				abort(c, http.StatusConflict, "Request with this Idempotency-Key is in progress")
+			default:
+				c.Writer.Header().Set(ReplayedHeader, "true")
+				c.Data(existing.Status, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		rec := &recorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		c.Next()
+
+		// server errors are not final, the client may retry with the same key
+		if rec.Status() >= http.StatusInternalServerError {
+			if err := config.Store.Delete(record.Key); err != nil {
+				log.Println("Idempotency: " + err.Error() + " traceId " + c.GetString("traceId"))
+			}
+			return
+		}
+
+		record.Completed = true
+		record.Status = rec.Status()
+		record.ContentType = rec.Header().Get("Content-Type")
+		record.Body = rec.body.Bytes()
+		record.ExpiresAt = time.Now().Add(config.TTL)
+
+		if err := config.Store.Complete(record); err != nil {
+			log.Println("Idempotency: " + err.Error() + " traceId " + c.GetString("traceId"))
+		}
+	}
+}
+
+func abort(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{"message": message})
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+}
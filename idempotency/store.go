@@ -0,0 +1,233 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/bradfitz/gomemcache/memcache"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sync"
+	"time"
+)
+
+var ErrConflict = errors.New("idempotency: concurrent updates of the key")
+
+// Record is the stored response of the first request with an Idempotency-Key.
+//
+//	CREATE TABLE idempotency_key (
+//		key          varchar(64) PRIMARY KEY,
+//		request_hash varchar(64) NOT NULL,
+//		completed    boolean NOT NULL DEFAULT false,
+//		status       integer NOT NULL DEFAULT 0,
+//		content_type varchar(255) NOT NULL DEFAULT '',
+//		body         bytea,
+//		created_at   timestamptz NOT NULL,
+//		expires_at   timestamptz NOT NULL
+//	);
+type Record struct {
+	Key         string    `gorm:"column:key;primaryKey" json:"key"`
+	RequestHash string    `gorm:"column:request_hash" json:"request_hash"`
+	Completed   bool      `gorm:"column:completed" json:"completed"`
+	Status      int       `gorm:"column:status" json:"status"`
+	ContentType string    `gorm:"column:content_type" json:"content_type"`
+	Body        []byte    `gorm:"column:body" json:"body"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+	ExpiresAt   time.Time `gorm:"column:expires_at" json:"expires_at"`
+}
+
+func (r *Record) TableName() string {
+	return "idempotency_key"
+}
+
+func (r *Record) expired(now time.Time) bool {
+	return now.After(r.ExpiresAt)
+}
+
+// Store keeps records, Begin has to be atomic between replicas.
+type Store interface {
+	// Begin stores the pending record unless a live record of the key exists, which is returned instead.
+	Begin(record Record) (*Record, error)
+	Complete(record Record) error
+	// Delete releases the key of a failed request for retries.
+	Delete(key string) error
+}
+
+// sweepInterval is the pause between removals of expired records of MemoryStore.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps records of a single replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	sweptAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}, sweptAt: time.Now()}
+}
+
+func (s *MemoryStore) Begin(record Record) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.sweptAt) > sweepInterval {
+		s.sweep(now)
+	}
+
+	if r, ok := s.records[record.Key]; ok {
+		if !r.expired(now) {
+			return &r, nil
+		}
+		delete(s.records, record.Key)
+	}
+
+	s.records[record.Key] = record
+	return nil, nil
+}
+
+// sweep removes the expired records, records which are never retried would stay otherwise.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, r := range s.records {
+		if r.expired(now) {
+			delete(s.records, key)
+		}
+	}
+	s.sweptAt = now
+}
+
+func (s *MemoryStore) Complete(record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.Key] = record
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// MemcacheStore shares records between replicas, usually on the CACHE_SRV connection.
+type MemcacheStore struct {
+	client *memcache.Client
+	prefix string
+}
+
+func NewMemcacheStore(client *memcache.Client) *MemcacheStore {
+	return &MemcacheStore{client: client, prefix: "idempotency:"}
+}
+
+func (s *MemcacheStore) Begin(record Record) (*Record, error) {
+	item, err := s.item(record)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < 2; i++ {
+		// Add fails when the key exists, which makes the check atomic across replicas
+		err = s.client.Add(item)
+		if err != memcache.ErrNotStored {
+			return nil, err
+		}
+
+		existing, err := s.client.Get(item.Key)
+		if err == memcache.ErrCacheMiss {
+			// expired in between
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var r Record
+		if err := json.Unmarshal(existing.Value, &r); err != nil {
+			return nil, err
+		}
+		return &r, nil
+	}
+
+	return nil, ErrConflict
+}
+
+func (s *MemcacheStore) Complete(record Record) error {
+	item, err := s.item(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(item)
+}
+
+func (s *MemcacheStore) Delete(key string) error {
+	err := s.client.Delete(s.prefix + key)
+	if err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
+
+func (s *MemcacheStore) item(record Record) (*memcache.Item, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memcache.Item{
+		Key:        s.prefix + record.Key,
+		Value:      value,
+		Expiration: int32(time.Until(record.ExpiresAt)/time.Second) + 1,
+	}, nil
+}
+
+// GormStore keeps records in the idempotency_key table, see Record.
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Begin(record Record) (*Record, error) {
+	for i := 0; i < 2; i++ {
+		tx := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+		if tx.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var existing Record
+		err := s.db.Where("key = ?", record.Key).First(&existing).Error
+		if err == gorm.ErrRecordNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !existing.expired(time.Now()) {
+			return &existing, nil
+		}
+
+		err = s.db.Where("key = ? AND expires_at = ?", record.Key, existing.ExpiresAt).Delete(&Record{}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, ErrConflict
+}
+
+func (s *GormStore) Complete(record Record) error {
+	return s.db.Save(&record).Error
+}
+
+func (s *GormStore) Delete(key string) error {
+	return s.db.Where("key = ?", key).Delete(&Record{}).Error
+}
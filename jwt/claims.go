@@ -0,0 +1,137 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/runetid/go-sdk/models"
+	"strconv"
+	"time"
+)
+
+// Claims holds the registered claims of a token, all claims are available in Raw.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	Raw       map[string]interface{}
+}
+
+func parseClaims(b []byte) (*Claims, error) {
+	raw := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, ErrMalformed
+	}
+
+	c := &Claims{Raw: raw}
+	c.Subject = c.String("sub")
+	c.Issuer = c.String("iss")
+	c.ExpiresAt = c.time("exp")
+	c.NotBefore = c.time("nbf")
+	c.IssuedAt = c.time("iat")
+
+	switch aud := raw["aud"].(type) {
+	case string:
+		c.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				c.Audience = append(c.Audience, s)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Claims) String(name string) string {
+	switch v := c.Raw[name].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+func (c *Claims) Int64(name string) int64 {
+	switch v := c.Raw[name].(type) {
+	case json.Number:
+		i, _ := v.Int64()
+		return i
+	case string:
+		i, _ := strconv.ParseInt(v, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func (c *Claims) Bool(name string) bool {
+	v, _ := c.Raw[name].(bool)
+	return v
+}
+
+func (c *Claims) time(name string) time.Time {
+	n, ok := c.Raw[name].(json.Number)
+	if !ok {
+		return time.Time{}
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(f), 0)
+}
+
+// Roles returns the "role" claim or the "roles" list.
+func (c *Claims) Roles() []string {
+	if role := c.String("role"); role != "" {
+		return []string{role}
+	}
+
+	var roles []string
+	if list, ok := c.Raw["roles"].([]interface{}); ok {
+		for _, r := range list {
+			if s, ok := r.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	}
+	return roles
+}
+
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// User maps the claims issued by the users service to the user model, the id is taken from "id" or "sub".
+func (c *Claims) User() models.User {
+	id := c.Int64("id")
+	if id == 0 {
+		id = c.Int64("sub")
+	}
+
+	return models.User{
+		Id:           int(id),
+		LastName:     c.String("last_name"),
+		FirstName:    c.String("first_name"),
+		FatherName:   c.String("father_name"),
+		Email:        c.String("email"),
+		RunetId:      c.Int64("runet_id"),
+		Gender:       c.String("gender"),
+		Visible:      c.Bool("visible"),
+		PrimaryPhone: c.String("phone"),
+		Verified:     c.Bool("verified"),
+		Photo:        c.String("photo"),
+	}
+}
@@ -0,0 +1,253 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("jwt: malformed token")
+	ErrUnsupportedAlg   = errors.New("jwt: unsupported algorithm")
+	ErrUnknownKey       = errors.New("jwt: unknown signing key")
+	ErrInvalidSignature = errors.New("jwt: invalid signature")
+	ErrExpired          = errors.New("jwt: token is expired")
+	ErrMissingExpiry    = errors.New("jwt: token has no expiry")
+	ErrNotYetValid      = errors.New("jwt: token is not valid yet")
+	ErrInvalidIssuer    = errors.New("jwt: invalid issuer")
+	ErrInvalidAudience  = errors.New("jwt: invalid audience")
+)
+
+type Config struct {
+	// JWKS endpoint or file, HMACSecret is used for HS256 tokens
+	JWKSURL     string
+	JWKSFile    string
+	JWKSRefresh time.Duration
+	HMACSecret  string
+
+	Issuer   string
+	Audience string
+	// allowed clock skew for exp and nbf
+	Leeway time.Duration
+	// rejects tokens without exp, which would be valid forever
+	RequireExp bool
+}
+
+// ConfigFromEnv reads JWT_JWKS_URL, JWT_JWKS_FILE, JWT_HMAC_SECRET, JWT_ISSUER, JWT_AUDIENCE, JWT_LEEWAY
+// and JWT_REQUIRE_EXP, exp is required unless it is false.
+func ConfigFromEnv() Config {
+	config := Config{
+		JWKSURL:     os.Getenv("JWT_JWKS_URL"),
+		JWKSFile:    os.Getenv("JWT_JWKS_FILE"),
+		JWKSRefresh: time.Hour,
+		HMACSecret:  os.Getenv("JWT_HMAC_SECRET"),
+		Issuer:      os.Getenv("JWT_ISSUER"),
+		Audience:    os.Getenv("JWT_AUDIENCE"),
+		Leeway:      30 * time.Second,
+		RequireExp:  os.Getenv("JWT_REQUIRE_EXP") != "false",
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("JWT_LEEWAY")); err == nil {
+		config.Leeway = d
+	}
+
+	return config
+}
+
+// Enabled reports whether any verification key is configured.
+func (c Config) Enabled() bool {
+	return c.JWKSURL != "" || c.JWKSFile != "" || c.HMACSecret != ""
+}
+
+type Verifier struct {
+	config Config
+	keys   *KeySet
+	now    func() time.Time
+}
+
+func NewVerifier(config Config) (*Verifier, error) {
+	v := &Verifier{config: config, now: time.Now}
+
+	switch {
+	case config.JWKSFile != "":
+		keys, err := NewFileKeySet(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+	case config.JWKSURL != "":
+		v.keys = NewRemoteKeySet(config.JWKSURL, config.JWKSRefresh)
+	}
+
+	return v, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// LooksLikeJWT distinguishes JWTs from opaque tokens without verifying them.
+func LooksLikeJWT(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	_, err := decodeHeader(parts[0])
+	return err == nil
+}
+
+func decodeHeader(s string) (header, error) {
+	var h header
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return h, ErrMalformed
+	}
+	if err := json.Unmarshal(b, &h); err != nil || h.Alg == "" {
+		return h, ErrMalformed
+	}
+	return h, nil
+}
+
+// Verify checks the signature, time claims, issuer and audience of the token.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	h, err := decodeHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	if err := v.verifySignature(ctx, h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims, err := parseClaims(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, v.validate(claims)
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, h header, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch h.Alg {
+	case "HS256":
+		secret := []byte(v.config.HMACSecret)
+		if len(secret) == 0 {
+			key, err := v.key(ctx, h.Kid)
+			if err != nil {
+				return err
+			}
+			b, ok := key.([]byte)
+			if !ok {
+				return ErrUnknownKey
+			}
+			secret = b
+		}
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "RS256":
+		key, err := v.key(ctx, h.Kid)
+		if err != nil {
+			return err
+		}
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "ES256":
+		key, err := v.key(ctx, h.Kid)
+		if err != nil {
+			return err
+		}
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	return ErrUnsupportedAlg
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (interface{}, error) {
+	if v.keys == nil {
+		return nil, ErrUnknownKey
+	}
+	return v.keys.Key(ctx, kid)
+}
+
+func (v *Verifier) validate(c *Claims) error {
+	now := v.now()
+
+	if c.ExpiresAt.IsZero() && v.config.RequireExp {
+		return ErrMissingExpiry
+	}
+
+	if !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt.Add(v.config.Leeway)) {
+		return ErrExpired
+	}
+
+	if !c.NotBefore.IsZero() && now.Add(v.config.Leeway).Before(c.NotBefore) {
+		return ErrNotYetValid
+	}
+
+	if v.config.Issuer != "" && c.Issuer != v.config.Issuer {
+		return ErrInvalidIssuer
+	}
+
+	if v.config.Audience != "" {
+		for _, aud := range c.Audience {
+			if aud == v.config.Audience {
+				return nil
+			}
+		}
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func encode(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestVerifyHS256(t *testing.T) {
+	v, _ := NewVerifier(Config{HMACSecret: "secret", Issuer: "users", Audience: "api"})
+
+	signed := encode(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(t, map[string]interface{}{
+		"sub": "66427", "iss": "users", "aud": []string{"api"}, "role": "admin", "runet_id": 87610,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(signed))
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	if !LooksLikeJWT(token) || LooksLikeJWT("peOWZrIEzHmbQYjNtwWb") {
+		t.Fatal("Wrong token detection")
+	}
+
+	claims, err := v.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	u := claims.User()
+	if u.Id != 66427 || u.RunetId != 87610 || !claims.HasRole("admin") {
+		t.Fatalf("Unexpected claims %+v", u)
+	}
+
+	if _, err := v.Verify(context.Background(), token[:len(token)-2]+"AA"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected invalid signature, got %v", err)
+	}
+
+	t.Setenv("JWT_HMAC_SECRET", "secret")
+	v, _ = NewVerifier(ConfigFromEnv())
+	signed = encode(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(t, map[string]interface{}{"sub": "66427"})
+	mac = hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(signed))
+	if _, err := v.Verify(context.Background(), signed+"."+base64.RawURLEncoding.EncodeToString(mac.Sum(nil))); !errors.Is(err, ErrMissingExpiry) {
+		t.Fatalf("Expected token without exp rejected, got %v", err)
+	}
+}
+
+func TestVerifyRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, _ := NewVerifier(Config{Leeway: time.Second})
+	v.keys = NewStaticKeySet(map[string]interface{}{"k1": &key.PublicKey})
+
+	sign := func(claims map[string]interface{}) string {
+		signed := encode(t, map[string]string{"alg": "RS256", "kid": "k1"}) + "." + encode(t, claims)
+		digest := sha256.Sum256([]byte(signed))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+	}
+
+	if _, err := v.Verify(context.Background(), sign(map[string]interface{}{"sub": "1"})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expired := sign(map[string]interface{}{"sub": "1", "exp": time.Now().Add(-time.Minute).Unix()})
+	if _, err := v.Verify(context.Background(), expired); !errors.Is(err, ErrExpired) {
+		t.Fatalf("Expected expired token, got %v", err)
+	}
+}
+
+func TestKeySetThrottlesFailedLoads(t *testing.T) {
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	keys := NewRemoteKeySet(srv.URL, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys.Key(context.Background(), "unknown")
+		}()
+	}
+	wg.Wait()
+
+	if _, err := keys.Key(context.Background(), "other"); err == nil {
+		t.Fatal("Expected the load error")
+	}
+	if fetches != 1 {
+		t.Fatalf("Expected a single fetch, got %d", fetches)
+	}
+}
@@ -0,0 +1,252 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS decodes a JSON Web Key Set into public keys by key id.
+// RSA, P-256 EC and symmetric keys are supported, other keys are skipped.
+func ParseJWKS(b []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("jwt: decode jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: decode jwk: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// KeySet caches the keys of a JWKS endpoint or file and reloads them after
+// the refresh interval or when a token is signed with an unknown key id.
+type KeySet struct {
+	mu       sync.RWMutex
+	url      string
+	file     string
+	refresh  time.Duration
+	client   *http.Client
+	keys     map[string]interface{}
+	loadedAt time.Time
+	// last load attempt and its error, failed loads are throttled like successful ones
+	attemptedAt time.Time
+	loadErr     error
+
+	// collapses concurrent reloads into one request
+	loadMu sync.Mutex
+}
+
+func NewRemoteKeySet(url string, refresh time.Duration) *KeySet {
+	return &KeySet{url: url, refresh: refresh, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func NewFileKeySet(file string) (*KeySet, error) {
+	s := &KeySet{file: file}
+	if err := s.load(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewStaticKeySet is a key set of known keys, e.g. a single HS256 secret with an empty key id.
+func NewStaticKeySet(keys map[string]interface{}) *KeySet {
+	return &KeySet{keys: keys, loadedAt: time.Now()}
+}
+
+// minReload limits reloads triggered by unknown key ids or failed loads.
+const minReload = 30 * time.Second
+
+// Key returns the key with the id, a token without kid matches the only key of the set.
+// A stale set is still used while the endpoint is unreachable.
+func (s *KeySet) Key(ctx context.Context, kid string) (interface{}, error) {
+	s.mu.RLock()
+	key, ok := s.lookup(kid)
+	stale := s.url != "" && (s.keys == nil || (s.refresh > 0 && time.Since(s.loadedAt) > s.refresh))
+	due := s.url != "" && time.Since(s.attemptedAt) > minReload
+	lastErr := s.loadErr
+	s.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+
+	if due {
+		if err := s.reload(ctx); err != nil && !ok {
+			return nil, err
+		}
+
+		s.mu.RLock()
+		key, ok = s.lookup(kid)
+		s.mu.RUnlock()
+	} else if !ok && lastErr != nil {
+		return nil, lastErr
+	}
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// reload loads the keys unless another caller attempted it while this one waited.
+func (s *KeySet) reload(ctx context.Context) error {
+	started := time.Now()
+
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	s.mu.RLock()
+	loaded, err := s.attemptedAt.After(started), s.loadErr
+	s.mu.RUnlock()
+	if loaded {
+		return err
+	}
+
+	return s.load(ctx)
+}
+
+func (s *KeySet) lookup(kid string) (interface{}, bool) {
+	if key, ok := s.keys[kid]; ok {
+		return key, true
+	}
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+func (s *KeySet) load(ctx context.Context) error {
+	keys, err := s.read(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attemptedAt = time.Now()
+	s.loadErr = err
+	if err != nil {
+		return err
+	}
+
+	s.keys = keys
+	s.loadedAt = s.attemptedAt
+	return nil
+}
+
+func (s *KeySet) read(ctx context.Context) (map[string]interface{}, error) {
+	var b []byte
+	var err error
+
+	if s.file != "" {
+		b, err = os.ReadFile(s.file)
+	} else {
+		b, err = s.fetch(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(b)
+}
+
+func (s *KeySet) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("jwt: jwks endpoint returned " + res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
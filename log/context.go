@@ -0,0 +1,159 @@
+package log
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/models"
+	"github.com/runetid/go-sdk/trace"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+// FieldsKey stores the request fields in the gin context, gin only resolves string keys.
+const FieldsKey = "logFields"
+
+type fieldsKey struct{}
+
+// fieldSet is shared by the gin context and the request context, so fields added
+// by later middlewares are seen by both.
+type fieldSet struct {
+	mu     sync.RWMutex
+	fields logrus.Fields
+	// executions of each statement, for the N+1 detection of GormLogger
+	queries map[string]int
+}
+
+func (s *fieldSet) get(key string) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.fields[key]
+}
+
+func (s *fieldSet) countQuery(sql string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.queries == nil {
+		s.queries = map[string]int{}
+	}
+	s.queries[sql]++
+	return s.queries[sql]
+}
+
+func (s *fieldSet) set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fields[key] = value
+}
+
+func (s *fieldSet) copyTo(fields logrus.Fields) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, v := range s.fields {
+		fields[k] = v
+	}
+}
+
+func fieldsFrom(ctx context.Context) *fieldSet {
+	if ctx == nil {
+		return nil
+	}
+	if s, ok := ctx.Value(fieldsKey{}).(*fieldSet); ok {
+		return s
+	}
+	if s, ok := ctx.Value(FieldsKey).(*fieldSet); ok {
+		return s
+	}
+	return nil
+}
+
+// WithFields returns a context whose log entries carry the fields, e.g. for jobs and goroutines.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	s := &fieldSet{fields: logrus.Fields{}}
+	if parent := fieldsFrom(ctx); parent != nil {
+		parent.copyTo(s.fields)
+	}
+	for k, v := range fields {
+		s.fields[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, s)
+}
+
+// AddField adds a field to the log entries of the current request, see ContextMiddleware.
+func AddField(c *gin.Context, key string, value interface{}) {
+	s := fieldsFrom(c)
+	if s == nil {
+		s = attachFields(c)
+	}
+	s.set(key, value)
+}
+
+func attachFields(c *gin.Context) *fieldSet {
+	s := &fieldSet{fields: logrus.Fields{
+		"route":  c.FullPath(),
+		"method": c.Request.Method,
+	}}
+	c.Set(FieldsKey, s)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), fieldsKey{}, s))
+	return s
+}
+
+// ContextMiddleware adds route and method to the log entries of the request,
+// GinLoggerMiddleware does the same.
+func ContextMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if fieldsFrom(c) == nil {
+			attachFields(c)
+		}
+		c.Next()
+	}
+}
+
+// std is the logger of FromContext, the last one created by NewAppLoggerWithConfig.
+var std *logrus.Logger
+
+// FromContext returns an entry with the trace id, request fields and the user, role, event and
+// api account set by the sdk middlewares. It accepts the gin context, the request context and the
+// context passed to the List, Get, Create and Update methods of models.
+func FromContext(ctx context.Context) *logrus.Entry {
+	logger := std
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	return entryFromContext(logger, ctx)
+}
+
+func entryFromContext(logger *logrus.Logger, ctx context.Context) *logrus.Entry {
+	fields := logrus.Fields{}
+	if ctx == nil {
+		return logger.WithFields(fields)
+	}
+
+	if traceId := trace.FromContext(ctx); traceId != "" {
+		fields["traceId"] = traceId
+	}
+	if s := fieldsFrom(ctx); s != nil {
+		s.copyTo(fields)
+	}
+
+	// values of the sdk middlewares, only reachable through the gin context
+	switch u := ctx.Value("user").(type) {
+	case models.User:
+		fields["userId"] = u.Id
+	case *models.User:
+		if u != nil {
+			fields["userId"] = u.Id
+		}
+	}
+	if role, ok := ctx.Value("role").(string); ok && role != "" {
+		fields["role"] = role
+	}
+	if eventId := ctx.Value("event_id"); eventId != nil {
+		fields["eventId"] = eventId
+	}
+	if accountId, ok := ctx.Value("api_account_id").(int64); ok && accountId != 0 {
+		fields["apiAccountId"] = accountId
+	}
+
+	return logger.WithContext(ctx).WithFields(fields)
+}
@@ -0,0 +1,363 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrGelfUnavailable = errors.New("log: gelf sink unavailable")
+
+// GelfConfig of the Graylog output, see NewGelfHook.
+type GelfConfig struct {
+	// udp://host:12201, tcp://host:12201 or host:12201 for udp
+	Address string
+	// gzip, zlib or none, only udp messages are compressed
+	Compression string
+	// size of udp chunks, 1420 fits the MTU of most networks
+	ChunkSize int
+	// messages waiting for delivery, further messages are written to the fallback
+	BufferSize int
+	// static fields of every message, e.g. service, version and environment
+	Fields map[string]interface{}
+	// receives messages which could not be delivered as json lines, defaults to stdout
+	Fallback io.Writer
+	// dial and write timeout of the sink
+	Timeout time.Duration
+	// pause between reconnects to an unreachable sink
+	RetryInterval time.Duration
+}
+
+func DefaultGelfConfig(address string) GelfConfig {
+	return GelfConfig{
+		Address:       address,
+		Compression:   "gzip",
+		ChunkSize:     1420,
+		BufferSize:    10000,
+		Fallback:      os.Stdout,
+		Timeout:       time.Second,
+		RetryInterval: 5 * time.Second,
+	}
+}
+
+// GelfHook sends logrus entries to Graylog in the background, Fire never waits for the network.
+type GelfHook struct {
+	config  GelfConfig
+	network string
+	addr    string
+	host    string
+
+	// guards the queue against Fire after Close
+	mu     sync.RWMutex
+	closed bool
+	queue  chan []byte
+	done   chan struct{}
+
+	conn    net.Conn
+	retryAt time.Time
+	// guards the fallback writer used by Fire and the sender
+	fallbackMu sync.Mutex
+}
+
+func NewGelfHook(config GelfConfig) (*GelfHook, error) {
+	defaults := DefaultGelfConfig(config.Address)
+	if config.Compression == "" {
+		config.Compression = defaults.Compression
+	}
+	if config.ChunkSize <= 12 {
+		config.ChunkSize = defaults.ChunkSize
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaults.BufferSize
+	}
+	if config.Fallback == nil {
+		config.Fallback = defaults.Fallback
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = defaults.RetryInterval
+	}
+
+	network, addr, found := strings.Cut(config.Address, "://")
+	if !found {
+		network, addr = "udp", config.Address
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("log: unsupported gelf transport %q", network)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("log: gelf address %q: %w", config.Address, err)
+	}
+	switch config.Compression {
+	case "gzip", "zlib", "none":
+	default:
+		return nil, fmt.Errorf("log: unsupported gelf compression %q", config.Compression)
+	}
+
+	host, _ := os.Hostname()
+
+	h := &GelfHook{
+		config:  config,
+		network: network,
+		addr:    addr,
+		host:    host,
+		queue:   make(chan []byte, config.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go h.run()
+
+	return h, nil
+}
+
+func (h *GelfHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *GelfHook) Fire(entry *logrus.Entry) error {
+	message, err := h.message(entry)
+	if err != nil {
+		return err
+	}
+
+	h.mu.RLock()
+	if h.closed {
+		h.fallback(message)
+	} else {
+		select {
+		case h.queue <- message:
+		default:
+			h.fallback(message)
+		}
+	}
+	h.mu.RUnlock()
+
+	// logrus exits right after the hooks of a fatal entry
+	if entry.Level == logrus.FatalLevel {
+		h.Close()
+	}
+	return nil
+}
+
+// Close delivers the buffered messages and closes the connection.
+func (h *GelfHook) Close() error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+	h.mu.Unlock()
+	<-h.done
+
+	if h.conn != nil {
+		return h.conn.Close()
+	}
+	return nil
+}
+
+func (h *GelfHook) run() {
+	defer close(h.done)
+
+	for message := range h.queue {
+		if err := h.send(message); err != nil {
+			h.fallback(message)
+		}
+	}
+}
+
+func (h *GelfHook) fallback(message []byte) {
+	h.fallbackMu.Lock()
+	defer h.fallbackMu.Unlock()
+
+	h.config.Fallback.Write(append(message, '\n'))
+}
+
+func (h *GelfHook) send(message []byte) error {
+	if h.conn == nil {
+		if time.Now().Before(h.retryAt) {
+			return ErrGelfUnavailable
+		}
+
+		conn, err := net.DialTimeout(h.network, h.addr, h.config.Timeout)
+		if err != nil {
+			h.retryAt = time.Now().Add(h.config.RetryInterval)
+			return err
+		}
+		h.conn = conn
+	}
+
+	h.conn.SetWriteDeadline(time.Now().Add(h.config.Timeout))
+
+	var err error
+	if h.network == "tcp" {
+		// tcp messages are delimited by a null byte and can not be compressed
+		_, err = h.conn.Write(append(message, 0))
+	} else {
+		err = h.sendUDP(message)
+	}
+
+	if err != nil {
+		h.conn.Close()
+		h.conn = nil
+		h.retryAt = time.Now().Add(h.config.RetryInterval)
+	}
+	return err
+}
+
+const (
+	gelfChunkHeader = 12
+	gelfMaxChunks   = 128
+)
+
+func (h *GelfHook) sendUDP(message []byte) error {
+	payload, err := h.compress(message)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) <= h.config.ChunkSize {
+		_, err = h.conn.Write(payload)
+		return err
+	}
+
+	size := h.config.ChunkSize - gelfChunkHeader
+	count := (len(payload) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("log: gelf message of %d bytes exceeds %d chunks", len(payload), gelfMaxChunks)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, 0, h.config.ChunkSize)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, payload[i*size:end]...)
+
+		if _, err := h.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *GelfHook) compress(message []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+
+	switch h.config.Compression {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	default:
+		return message, nil
+	}
+
+	if _, err := w.Write(message); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *GelfHook) message(entry *logrus.Entry) ([]byte, error) {
+	short, full := entry.Message, ""
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short, full = short[:i], short
+	}
+
+	m := map[string]interface{}{
+		"version":       "1.1",
+		"host":          h.host,
+		"short_message": short,
+		"timestamp":     float64(entry.Time.UnixMilli()) / 1000,
+		"level":         syslogLevel(entry.Level),
+	}
+	if full != "" {
+		m["full_message"] = full
+	}
+
+	for k, v := range h.config.Fields {
+		m[gelfField(k)] = gelfValue(v)
+	}
+	for k, v := range entry.Data {
+		m[gelfField(k)] = gelfValue(v)
+	}
+	if entry.HasCaller() {
+		m["_file"] = entry.Caller.File
+		m["_line"] = entry.Caller.Line
+	}
+
+	return json.Marshal(m)
+}
+
+func syslogLevel(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0
+	case logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	}
+	return 7
+}
+
+var gelfInvalid = regexp.MustCompile(`[^\w.\-]`)
+
+// gelfField prefixes additional fields with _, the reserved _id is sent as _id_.
+func gelfField(key string) string {
+	key = gelfInvalid.ReplaceAllString(key, "_")
+	if key == "id" {
+		key = "id_"
+	}
+	return "_" + key
+}
+
+// gelfValue converts the value to a string or a number, the only types of additional fields.
+func gelfValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return value
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	case nil:
+		return ""
+	}
+
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
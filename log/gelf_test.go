@@ -0,0 +1,109 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGelfChunkedUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	config := DefaultGelfConfig("udp://" + pc.LocalAddr().String())
+	config.ChunkSize = 100
+	config.Fields = map[string]interface{}{"service": "events"}
+	hook, err := NewGelfHook(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(hook)
+	// random text does not compress into a single chunk
+	random := make([]byte, 1000)
+	rand.Read(random)
+	long := "payload " + hex.EncodeToString(random)
+	logger.WithFields(logrus.Fields{"id": 7, "traceId": "abc"}).Warn(long)
+	hook.Close()
+
+	chunks := map[byte][]byte{}
+	var count byte
+	buf := make([]byte, 200)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for count == 0 || len(chunks) < int(count) {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf[0] != 0x1e || buf[1] != 0x0f {
+			t.Fatalf("not chunked: % x", buf[:2])
+		}
+		count = buf[11]
+		chunks[buf[10]] = append([]byte{}, buf[12:n]...)
+	}
+
+	var payload []byte
+	for i := byte(0); i < count; i++ {
+		payload = append(payload, chunks[i]...)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message["short_message"] != long || message["level"] != float64(4) || message["_service"] != "events" ||
+		message["_traceId"] != "abc" || message["_id_"] != float64(7) {
+		t.Fatalf("message = %v", message)
+	}
+}
+
+func TestGelfFallback(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var fallback bytes.Buffer
+	config := DefaultGelfConfig("tcp://" + addr)
+	config.Fallback = &fallback
+	hook, err := NewGelfHook(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(hook)
+	logger.Info("first")
+	logger.Info("second")
+	hook.Close()
+
+	if !strings.Contains(fallback.String(), `"short_message":"first"`) || !strings.Contains(fallback.String(), `"short_message":"second"`) {
+		t.Fatalf("fallback = %s", fallback.String())
+	}
+}
+
+func TestGelfAddress(t *testing.T) {
+	if _, err := NewGelfHook(GelfConfig{Address: "http://graylog:12201"}); err == nil {
+		t.Fatal("http transport accepted")
+	}
+}
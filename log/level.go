@@ -0,0 +1,170 @@
+package log
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+)
+
+// Components with their own log level, everything else logs at the application level.
+const (
+	ComponentApp  = "app"
+	ComponentHTTP = "http"
+	ComponentGorm = "gorm"
+	ComponentRPC  = "rpc"
+)
+
+var Components = []string{ComponentApp, ComponentHTTP, ComponentGorm, ComponentRPC}
+
+// components share the output of the application logger, each with its own level.
+// Components without an own level follow the application level.
+type components struct {
+	mu        sync.RWMutex
+	base      *logrus.Logger
+	loggers   map[string]*logrus.Logger
+	overrides map[string]bool
+}
+
+func newComponents(base *logrus.Logger) *components {
+	cs := &components{
+		base:      base,
+		loggers:   map[string]*logrus.Logger{ComponentApp: base},
+		overrides: map[string]bool{},
+	}
+
+	for _, name := range Components[1:] {
+		cs.loggers[name] = &logrus.Logger{
+			Out:          base.Out,
+			Hooks:        base.Hooks,
+			Formatter:    base.Formatter,
+			ReportCaller: base.ReportCaller,
+			Level:        base.GetLevel(),
+			ExitFunc:     base.ExitFunc,
+		}
+	}
+
+	return cs
+}
+
+func (cs *components) get(name string) *logrus.Logger {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if l, ok := cs.loggers[name]; ok {
+		return l
+	}
+	return cs.base
+}
+
+func (cs *components) set(name string, level string) error {
+	if name == "" {
+		name = ComponentApp
+	}
+
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	l, ok := cs.loggers[name]
+	if !ok {
+		return fmt.Errorf("log: unknown component %q", name)
+	}
+	l.SetLevel(lvl)
+
+	if name != ComponentApp {
+		cs.overrides[name] = true
+		return nil
+	}
+
+	for n, other := range cs.loggers {
+		if !cs.overrides[n] {
+			other.SetLevel(lvl)
+		}
+	}
+	return nil
+}
+
+func (cs *components) levels() map[string]string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	levels := make(map[string]string, len(cs.loggers))
+	for name, l := range cs.loggers {
+		levels[name] = l.GetLevel().String()
+	}
+	return levels
+}
+
+// SetLevel changes the level of a component at runtime, an empty component changes the application level.
+func (l AppLogger) SetLevel(component string, level string) error {
+	if l.components == nil {
+		lvl, err := logrus.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		l.logger.SetLevel(lvl)
+		return nil
+	}
+	return l.components.set(component, level)
+}
+
+// Levels returns the current level of every component.
+func (l AppLogger) Levels() map[string]string {
+	if l.components == nil {
+		return map[string]string{ComponentApp: l.logger.GetLevel().String()}
+	}
+	return l.components.levels()
+}
+
+// Component returns the logger of http, gorm or rpc, the application logger otherwise.
+func (l AppLogger) Component(name string) *logrus.Logger {
+	if l.components == nil {
+		return l.logger
+	}
+	return l.components.get(name)
+}
+
+type levelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level" binding:"required"`
+}
+
+// LevelHandler returns the levels on GET and changes one on PUT with {"component": "gorm", "level": "debug"}.
+// Levels are changed in the current process only.
+func LevelHandler(logger *AppLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodPut || c.Request.Method == http.MethodPost {
+			var request levelRequest
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				c.Writer.WriteHeaderNow()
+				c.Abort()
+				return
+			}
+
+			if err := logger.SetLevel(request.Component, request.Level); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				c.Writer.WriteHeaderNow()
+				c.Abort()
+				return
+			}
+
+			logger.Warn(fmt.Sprintf("log level of %s changed to %s", componentName(request.Component), request.Level))
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": logger.Levels()})
+	}
+}
+
+func componentName(name string) string {
+	if name == "" {
+		return ComponentApp
+	}
+	return name
+}
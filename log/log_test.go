@@ -0,0 +1,216 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/runetid/go-sdk/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevels(t *testing.T) {
+	l := NewAppLoggerWithConfig(Config{Level: "warn", Levels: map[string]string{ComponentGorm: "error"}})
+
+	if got := l.Component(ComponentHTTP).GetLevel(); got != logrus.WarnLevel {
+		t.Fatalf("http level = %s", got)
+	}
+
+	if err := l.SetLevel("", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	levels := l.Levels()
+	if levels[ComponentHTTP] != "debug" || levels[ComponentGorm] != "error" {
+		t.Fatalf("levels = %v", levels)
+	}
+
+	if err := l.SetLevel("queue", "info"); err == nil {
+		t.Fatal("unknown component accepted")
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := NewAppLoggerWithConfig(DefaultConfig())
+
+	r := gin.New()
+	r.PUT("/log", LevelHandler(&l))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/log", strings.NewReader(`{"component":"rpc","level":"debug"}`)))
+	if w.Code != http.StatusOK || l.Component(ComponentRPC).GetLevel() != logrus.DebugLevel {
+		t.Fatalf("status %d, level %s", w.Code, l.Component(ComponentRPC).GetLevel())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/log", strings.NewReader(`{"level":"loud"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d", w.Code)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor(DefaultRedactKeys)
+
+	query := r.Values(map[string][]string{"api_key": {"k"}, "limit": {"10"}})
+	if query.Get("api_key") != Redacted || query.Get("limit") != "10" {
+		t.Fatalf("query = %v", query)
+	}
+
+	header := r.Header(http.Header{"Apikey": {"k"}, "Accept": {"*/*"}})
+	if header["Apikey"] != Redacted || header["Accept"] != "*/*" {
+		t.Fatalf("header = %v", header)
+	}
+
+	params := []interface{}{"a@b.c", "secret", int64(1)}
+	got := r.SQLParams(`UPDATE "user" SET "email"=$1,"password_hash"=$2 WHERE "id" = $3`, params)
+	if got[0] != "a@b.c" || got[1] != Redacted || got[2] != int64(1) || params[1] != "secret" {
+		t.Fatalf("update params = %v", got)
+	}
+
+	got = r.SQLParams(`INSERT INTO "account" ("name","secret") VALUES ($1,$2),($3,$4) RETURNING "id"`, []interface{}{"a", "s1", "b", "s2"})
+	if got[0] != "a" || got[1] != Redacted || got[2] != "b" || got[3] != Redacted {
+		t.Fatalf("insert params = %v", got)
+	}
+
+	got = r.SQLParams(`SELECT * FROM "token" WHERE token IN ($1,$2) AND "id" = $3`, []interface{}{"t1", "t2", 1})
+	if got[0] != Redacted || got[1] != Redacted || got[2] != 1 {
+		t.Fatalf("select params = %v", got)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s := NewSampler(2, 3)
+
+	var allowed []bool
+	for i := 0; i < 8; i++ {
+		allowed = append(allowed, s.Allow("GET /list 200"))
+	}
+
+	want := []bool{true, true, false, false, true, false, false, true}
+	for i := range want {
+		if allowed[i] != want[i] {
+			t.Fatalf("allowed = %v", allowed)
+		}
+	}
+
+	if !s.Allow("GET /get 200") {
+		t.Fatal("other key sampled")
+	}
+}
+
+func TestGinLoggerRedactsQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := NewAppLoggerWithConfig(DefaultConfig())
+	var out bytes.Buffer
+	l.Component(ComponentHTTP).SetOutput(&out)
+
+	r := gin.New()
+	r.Use(GinLoggerMiddleware(&l, GinLoggerMiddlewareParams{}))
+	r.GET("/list", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/list?password=qwerty&limit=10", nil))
+
+	if strings.Contains(out.String(), "qwerty") || !strings.Contains(out.String(), Redacted) {
+		t.Fatalf("log = %s", out.String())
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := NewAppLoggerWithConfig(DefaultConfig())
+	var out bytes.Buffer
+	l.GetLogger().SetOutput(&out)
+	l.GetLogger().SetFormatter(&logrus.JSONFormatter{})
+
+	r := gin.New()
+	r.Use(ContextMiddleware())
+	r.GET("/event/:id", func(c *gin.Context) {
+		c.Set("user", &models.User{Id: 5})
+		c.Set("event_id", int64(7))
+		c.Set("api_account_id", int64(3))
+		AddField(c, "entity", "event")
+
+		// the context received by the model methods
+		ctx := context.WithoutCancel(c)
+		FromContext(ctx).Info("list")
+		l.Slog(ComponentApp).InfoContext(ctx, "slog", slog.Group("request", "limit", 10))
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/event/1", nil))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log = %s", out.String())
+	}
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["route"] != "/event/:id" || entry["method"] != "GET" || entry["userId"] != float64(5) ||
+			entry["eventId"] != float64(7) || entry["apiAccountId"] != float64(3) || entry["entity"] != "event" {
+			t.Fatalf("entry = %v", entry)
+		}
+	}
+	if !strings.Contains(lines[1], `"request.limit":10`) {
+		t.Fatalf("slog entry = %s", lines[1])
+	}
+}
+
+type account struct {
+	Id     int64
+	Secret string
+}
+
+func TestGormSlowAndRepeatedQueries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := NewAppLoggerWithConfig(Config{Level: "warn"})
+	var out bytes.Buffer
+	l.Component(ComponentGorm).SetOutput(&out)
+
+	gormLogger := NewGormLogger(&l)
+	gormLogger.SlowThreshold = time.Nanosecond
+	gormLogger.NPlusOneThreshold = 3
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: gormLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(gormLogger); err != nil {
+		t.Fatal(err)
+	}
+
+	slow := testutil.ToFloat64(slowQueriesTotal.WithLabelValues("select", "accounts"))
+	repeated := testutil.ToFloat64(repeatedQueriesTotal.WithLabelValues("/account/:id"))
+
+	r := gin.New()
+	r.Use(ContextMiddleware())
+	r.GET("/account/:id", func(c *gin.Context) {
+		for i := 0; i < 4; i++ {
+			db.WithContext(c).Where("id = ? AND secret = ?", i, "qwerty").First(&account{})
+		}
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/account/1", nil))
+
+	if got := testutil.ToFloat64(slowQueriesTotal.WithLabelValues("select", "accounts")) - slow; got != 4 {
+		t.Fatalf("slow queries = %v", got)
+	}
+	if got := testutil.ToFloat64(repeatedQueriesTotal.WithLabelValues("/account/:id")) - repeated; got != 1 {
+		t.Fatalf("repeated queries = %v", got)
+	}
+	if strings.Count(out.String(), "possible N+1 query") != 1 || strings.Contains(out.String(), "qwerty") {
+		t.Fatalf("log = %s", out.String())
+	}
+	if !strings.Contains(out.String(), "log_test.go") {
+		t.Fatalf("source missing: %s", out.String())
+	}
+}
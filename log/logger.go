@@ -5,44 +5,188 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/runetid/go-sdk/trace"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
 	"gorm.io/gorm/utils"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// GetTraceId returns the trace id of the request, see trace.Middleware.
 func GetTraceId(c *gin.Context) string {
-	request := c.Request.Header.Get("X-Trace-Id")
+	return trace.Get(c)
+}
 
-	if request == uuid.New().String() {
+// Config of the application logger, see ConfigFromEnv.
+type Config struct {
+	// level of the application and of components without an own level
+	Level string
+	// levels of the http, gorm and rpc components
+	Levels map[string]string
+	// logs the first SampleInitial successful requests of a route per second
+	// and every SampleThereafter-th after them, 0 logs every request
+	SampleInitial    int
+	SampleThereafter int
+	// keys redacted in query params, headers and sql parameters, nil uses DefaultRedactKeys
+	RedactKeys []string
+	// graylog address like udp://graylog:12201 or tcp://graylog:12201, empty logs to stdout only
+	Channel string
+	// static fields of every graylog message
+	Fields map[string]interface{}
+}
 
+func DefaultConfig() Config {
+	return Config{
+		Level:            "info",
+		Levels:           map[string]string{ComponentGorm: "warn"},
+		SampleThereafter: 100,
+		RedactKeys:       DefaultRedactKeys,
 	}
+}
 
-	return request
+// ConfigFromEnv reads LOG_LEVEL, LOG_LEVEL_HTTP, LOG_LEVEL_GORM, LOG_LEVEL_RPC, LOG_SAMPLE_INITIAL,
+// LOG_SAMPLE_THEREAFTER and LOG_REDACT_KEYS over the defaults, redact keys are added to the default ones.
+// LOG_CHANNEL enables graylog with service, version and environment fields
+// from SERVICE_NAME (or OTEL_SERVICE_NAME), SERVICE_VERSION and ENVIRONMENT.
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		config.Level = level
+	}
+	for _, component := range Components[1:] {
+		if level := os.Getenv("LOG_LEVEL_" + strings.ToUpper(component)); level != "" {
+			config.Levels[component] = level
+		}
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOG_SAMPLE_INITIAL")); err == nil {
+		config.SampleInitial = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOG_SAMPLE_THEREAFTER")); err == nil {
+		config.SampleThereafter = n
+	}
+	for _, key := range strings.Split(os.Getenv("LOG_REDACT_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			config.RedactKeys = append(config.RedactKeys, key)
+		}
+	}
+
+	config.Channel = os.Getenv("LOG_CHANNEL")
+	config.Fields = map[string]interface{}{
+		"service":     serviceName(),
+		"environment": strings.ToLower(os.Getenv("ENVIRONMENT")),
+	}
+	if version := os.Getenv("SERVICE_VERSION"); version != "" {
+		config.Fields["version"] = version
+	}
+
+	return config
+}
+
+func serviceName() string {
+	if name := os.Getenv("SERVICE_NAME"); name != "" {
+		return name
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return filepath.Base(os.Args[0])
 }
 
 func NewAppLogger() AppLogger {
+	return NewAppLoggerWithConfig(ConfigFromEnv())
+}
+
+func NewAppLoggerWithConfig(config Config) AppLogger {
 
 	logger := logrus.New()
-	if strings.ToUpper(os.Getenv("ENVIRONMENT")) != "DEV" {
+	dev := strings.ToUpper(os.Getenv("ENVIRONMENT")) == "DEV"
+	if !dev {
 		logger.Formatter = &logrus.JSONFormatter{}
 	}
+
+	var gelf *GelfHook
+	if config.Channel != "" {
+		gelfConfig := DefaultGelfConfig(config.Channel)
+		gelfConfig.Fields = config.Fields
+		if dev {
+			// logs stay on the console in development
+			gelfConfig.Fallback = io.Discard
+		}
+
+		hook, err := NewGelfHook(gelfConfig)
+		if err != nil {
+			logger.Warn(err)
+		} else {
+			gelf = hook
+			logger.AddHook(hook)
+			if !dev {
+				// the hook writes undelivered messages to stdout itself
+				logger.SetOutput(io.Discard)
+			}
+		}
+	}
 	log.SetOutput(logger.Writer())
 
-	return AppLogger{logger: logger}
+	if config.RedactKeys == nil {
+		config.RedactKeys = DefaultRedactKeys
+	}
+
+	l := AppLogger{
+		logger:     logger,
+		gelf:       gelf,
+		components: newComponents(logger),
+		sampler:    NewSampler(config.SampleInitial, config.SampleThereafter),
+		redactor:   NewRedactor(config.RedactKeys),
+	}
+
+	if config.Level != "" {
+		if err := l.SetLevel(ComponentApp, config.Level); err != nil {
+			logger.Warn(err)
+		}
+	}
+	for component, level := range config.Levels {
+		if err := l.SetLevel(component, level); err != nil {
+			logger.Warn(err)
+		}
+	}
+
+	std = logger
+	return l
 
 }
 
 type AppLogger struct {
-	logger  *logrus.Logger
+	logger     *logrus.Logger
+	components *components
+	sampler    *Sampler
+	redactor   *Redactor
+	gelf       *GelfHook
+	// Deprecated: use FromContext, the trace id is read from the context.
 	TraceId string
 }
 
+// Close delivers the buffered graylog messages, call it before the process exits.
+func (l AppLogger) Close() error {
+	if l.gelf == nil {
+		return nil
+	}
+	return l.gelf.Close()
+}
+
+// Redactor returns the redactor of the configured keys, nil redacts nothing.
+func (l AppLogger) Redactor() *Redactor {
+	return l.redactor
+}
+
 func (l AppLogger) Info(v ...any) {
 	l.logger.Info(v...)
 }
@@ -55,11 +199,9 @@ func (l AppLogger) Error(v ...any) {
 	l.logger.Error(v...)
 }
 
+// WithContext returns an entry with the request fields, see FromContext.
 func (l AppLogger) WithContext(ctx context.Context) *logrus.Entry {
-
-	return l.logger.WithFields(logrus.Fields{
-		"traceId": ctx.Value("traceId"),
-	})
+	return entryFromContext(l.logger, ctx)
 }
 
 func (l AppLogger) GetLogger() *logrus.Logger {
@@ -93,6 +235,10 @@ func GinLoggerMiddleware(appLogger *AppLogger, params GinLoggerMiddlewareParams)
 		// defined on the router
 		matchPath := c.FullPath()
 
+		if fieldsFrom(c) == nil {
+			attachFields(c)
+		}
+
 		if _, ok := skipMap[matchPath]; !ok {
 			// get the context of the request
 			//ctx := c.Request.Context()
@@ -134,101 +280,147 @@ func GinLoggerMiddleware(appLogger *AppLogger, params GinLoggerMiddlewareParams)
 
 			msg := fmt.Sprintf("[%s] %d %s (%dms)", timestamp.Format(time.RFC3339), statusCode, path, latency.Milliseconds())
 
+			logger := appLogger.Component(ComponentHTTP)
+			if statusCode < 400 && !appLogger.sampler.Allow(c.Request.Method+" "+matchPath+" "+strconv.Itoa(statusCode)) {
+				return
+			}
+
+			fields := logrus.Fields{
+				"path":  c.Request.URL.Path,
+				"query": appLogger.redactor.Values(c.Request.URL.Query()),
+			}
+			if logger.IsLevelEnabled(logrus.DebugLevel) {
+				fields["headers"] = appLogger.redactor.Header(c.Request.Header)
+			}
+
 			if statusCode >= 500 {
-				appLogger.logger.WithFields(logrus.Fields{
-					"method":  c.Request.Method,
-					"path":    c.Request.URL.Path,
-					"query":   c.Request.URL.Query(),
-					"traceId": c.Value("traceId"),
-				}).Error(msg)
+				entryFromContext(logger, c).WithFields(fields).Error(msg)
 			} else if statusCode >= 400 {
-				appLogger.logger.WithFields(logrus.Fields{
-					"method":  c.Request.Method,
-					"path":    c.Request.URL.Path,
-					"query":   c.Request.URL.Query(),
-					"traceId": c.Value("traceId"),
-				}).Warn(msg)
+				entryFromContext(logger, c).WithFields(fields).Warn(msg)
 			} else {
-				appLogger.logger.WithFields(logrus.Fields{
-					"method":  c.Request.Method,
-					"path":    c.Request.URL.Path,
-					"query":   c.Request.URL.Query(),
-					"traceId": c.Value("traceId"),
-				}).Info(msg)
+				entryFromContext(logger, c).WithFields(fields).Info(msg)
 			}
 		}
 	}
 }
 
+// span records the query, the statement with its values is only exported in Debug mode.
+func (l *GormLogger) span(ctx context.Context, begin time.Time, sql string, rows int64, err error) {
+	if !trace.Enabled() {
+		return
+	}
+
+	operation, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+	operation = strings.ToUpper(operation)
+	attributes := map[string]interface{}{
+		"db.system":        "postgresql",
+		"db.operation":     operation,
+		"db.rows_affected": rows,
+	}
+	if l.debug() {
+		attributes["db.statement"] = sql
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	trace.RecordSpan(ctx, "gorm "+operation, trace.KindClient, begin, attributes, err)
+}
+
+// GormLogger logs failed queries at Error, slow queries at Warn and every query at Debug
+// level of the gorm component, parameters of sensitive columns are redacted.
 type GormLogger struct {
 	SlowThreshold         time.Duration
 	SourceField           string
 	SkipErrRecordNotFound bool
-	Debug                 bool
-	logger                *logrus.Logger
+	// exports statements to spans and logs every query at Info level
+	Debug bool
+	// runs EXPLAIN (FORMAT JSON) for this share of slow selects, 0 disables it
+	ExplainRate float64
+	// warns when a statement is repeated this many times within one request, 0 disables the check
+	NPlusOneThreshold int
+	logger            *logrus.Logger
+	redactor          *Redactor
+	db                atomic.Pointer[gorm.DB]
 }
 
+// NewGormLogger reads DB_SLOW_QUERY_THRESHOLD (default 200ms), DB_SLOW_QUERY_EXPLAIN_RATE
+// and DB_N_PLUS_ONE_THRESHOLD (default 10), see Initialize for the plugin part.
 func NewGormLogger(logger *AppLogger) *GormLogger {
-	return &GormLogger{
+	l := &GormLogger{
+		SlowThreshold:         200 * time.Millisecond,
+		SourceField:           "source",
 		SkipErrRecordNotFound: true,
-		Debug:                 true,
-		logger:                logger.GetLogger(),
+		NPlusOneThreshold:     10,
+		logger:                logger.Component(ComponentGorm),
+		redactor:              logger.Redactor(),
 	}
+	l.configFromEnv()
+	return l
 }
 
 func (l *GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
 	return l
 }
 
-func (l *GormLogger) Info(ctx context.Context, s string, args ...interface{}) {
+// ParamsFilter is called by gorm before the parameters are interpolated into the logged statement.
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, l.redactor.SQLParams(sql, params)
+}
 
-	l.logger.Info(s)
+func (l *GormLogger) debug() bool {
+	return l.Debug || l.logger.IsLevelEnabled(logrus.DebugLevel)
+}
 
-	l.logger.Infof(s, args)
+func (l *GormLogger) Info(ctx context.Context, s string, args ...interface{}) {
+	l.logger.Infof(s, args...)
 }
 
 func (l *GormLogger) Warn(ctx context.Context, s string, args ...interface{}) {
-	l.logger.Warn(s)
-	l.logger.Warnf(s, args)
+	l.logger.Warnf(s, args...)
 }
 
 func (l *GormLogger) Error(ctx context.Context, s string, args ...interface{}) {
-	l.logger.Error(s)
+	l.logger.Errorf(s, args...)
 }
 
 func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
 	elapsed := time.Since(begin)
-	sql, _ := fc()
-	fields := logrus.Fields{}
-	if l.SourceField != "" {
-		fields[l.SourceField] = utils.FileWithLineNum()
-	}
-
-	fields["traceId"] = ctx.Value("traceId")
+	failed := err != nil && !(errors.Is(err, gorm.ErrRecordNotFound) && l.SkipErrRecordNotFound)
+	slow := l.SlowThreshold != 0 && elapsed > l.SlowThreshold
+	repeats := l.NPlusOneThreshold > 0 && fieldsFrom(ctx) != nil
 
-	if err != nil && !(errors.Is(err, gorm.ErrRecordNotFound) && l.SkipErrRecordNotFound) {
-		l.logger.WithField("test", "1").Error(sql)
-		//fields[l.logger.ErrorKey] = err
-		l.logger.WithFields(fields).Errorf("%s [%s]", sql, elapsed)
+	if !failed && !slow && !repeats && !l.debug() && !trace.Enabled() {
 		return
 	}
 
-	if l.SlowThreshold != 0 && elapsed > l.SlowThreshold {
-		l.logger.WithField("test", "2").Warn(sql)
-		l.logger.WithFields(fields).Warnf("%s [%s]", sql, elapsed)
+	sql, rows := fc()
+	source := utils.FileWithLineNum()
+	l.span(ctx, begin, sql, rows, err)
+	l.observe(ctx, sql, slow, source)
+
+	if !failed && !slow && !l.debug() {
 		return
 	}
 
-	if l.Debug {
-
-		//entry := logrus.NewEntry(l.logger)
-		//entry.WithField("test", "3")
-		//entry.Info(sql)
-
-		//l.logger.Infof(sql)
-
-		l.logger.WithFields(fields).Info(sql)
+	fields := logrus.Fields{
+		"rows":    rows,
+		"elapsed": elapsed.Milliseconds(),
+	}
+	if l.SourceField != "" {
+		fields[l.SourceField] = source
+	}
 
-		l.logger.WithFields(fields).Debugf("%s [%s]", sql, elapsed)
+	entry := entryFromContext(l.logger, ctx)
+	switch {
+	case failed:
+		fields[logrus.ErrorKey] = err
+		entry.WithFields(fields).Errorf("%s [%s]", sql, elapsed)
+	case slow:
+		entry.WithFields(fields).Warnf("%s [%s]", sql, elapsed)
+	case l.Debug:
+		entry.WithFields(fields).Infof("%s [%s]", sql, elapsed)
+	default:
+		entry.WithFields(fields).Debugf("%s [%s]", sql, elapsed)
 	}
 }
@@ -0,0 +1,140 @@
+package log
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const Redacted = "[redacted]"
+
+// DefaultRedactKeys are matched as substrings, so access_token and password_hash are redacted as well.
+var DefaultRedactKeys = []string{"password", "secret", "token", "apikey", "hash", "authorization"}
+
+// Redactor hides the values of sensitive keys in query params, headers and sql parameters.
+type Redactor struct {
+	keys []string
+}
+
+// NewRedactor matches keys case-insensitively ignoring _ and -, e.g. apikey matches ApiKey and api_key.
+func NewRedactor(keys []string) *Redactor {
+	r := &Redactor{}
+	for _, key := range keys {
+		if key = normalizeKey(key); key != "" {
+			r.keys = append(r.keys, key)
+		}
+	}
+	return r
+}
+
+func normalizeKey(key string) string {
+	key = strings.ToLower(key)
+	key = strings.ReplaceAll(key, "_", "")
+	return strings.ReplaceAll(key, "-", "")
+}
+
+// Sensitive reports whether the value of the key must not be logged.
+func (r *Redactor) Sensitive(key string) bool {
+	if r == nil {
+		return false
+	}
+
+	key = normalizeKey(key)
+	for _, k := range r.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns a copy of the query params with sensitive values redacted.
+func (r *Redactor) Values(values url.Values) url.Values {
+	redacted := make(url.Values, len(values))
+	for key, v := range values {
+		if r.Sensitive(key) {
+			redacted[key] = []string{Redacted}
+			continue
+		}
+		redacted[key] = v
+	}
+	return redacted
+}
+
+// Header returns a copy of the headers with sensitive values redacted.
+func (r *Redactor) Header(header http.Header) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for key, v := range header {
+		if r.Sensitive(key) {
+			redacted[key] = Redacted
+			continue
+		}
+		redacted[key] = strings.Join(v, ", ")
+	}
+	return redacted
+}
+
+var (
+	sqlCompare = regexp.MustCompile(`(?i)"?([a-z_][a-z0-9_]*)"?\s*(?:=|<>|!=|\bi?like\b)\s*\$(\d+)`)
+	sqlIn      = regexp.MustCompile(`(?i)"?([a-z_][a-z0-9_]*)"?\s+in\s*\(([^()]*)\)`)
+	sqlInsert  = regexp.MustCompile(`(?is)^\s*insert\s+into\s+\S+\s*\(([^)]*)\)\s*values\s*(.*)$`)
+	sqlTuple   = regexp.MustCompile(`\(([^()]*)\)`)
+	sqlParam   = regexp.MustCompile(`\$(\d+)`)
+)
+
+// SQLParams replaces the parameters bound to sensitive columns, the statement uses $n placeholders
+// as built by gorm before the values are interpolated. Comparisons, SET clauses and inserted columns are covered.
+func (r *Redactor) SQLParams(sql string, params []interface{}) []interface{} {
+	if r == nil || len(r.keys) == 0 || len(params) == 0 {
+		return params
+	}
+
+	var redacted []interface{}
+	redact := func(n int) {
+		if n < 1 || n > len(params) {
+			return
+		}
+		if redacted == nil {
+			redacted = append([]interface{}{}, params...)
+		}
+		redacted[n-1] = Redacted
+	}
+
+	for _, m := range sqlCompare.FindAllStringSubmatch(sql, -1) {
+		if r.Sensitive(m[1]) {
+			n, _ := strconv.Atoi(m[2])
+			redact(n)
+		}
+	}
+
+	for _, m := range sqlIn.FindAllStringSubmatch(sql, -1) {
+		if r.Sensitive(m[1]) {
+			for _, p := range sqlParam.FindAllStringSubmatch(m[2], -1) {
+				n, _ := strconv.Atoi(p[1])
+				redact(n)
+			}
+		}
+	}
+
+	if m := sqlInsert.FindStringSubmatch(sql); m != nil {
+		columns := strings.Split(m[1], ",")
+		for _, tuple := range sqlTuple.FindAllStringSubmatch(m[2], -1) {
+			for i, value := range strings.Split(tuple[1], ",") {
+				if i >= len(columns) || !r.Sensitive(strings.Trim(strings.TrimSpace(columns[i]), `"`)) {
+					continue
+				}
+				if p := sqlParam.FindStringSubmatch(value); p != nil {
+					n, _ := strconv.Atoi(p[1])
+					redact(n)
+				}
+			}
+		}
+	}
+
+	if redacted == nil {
+		return params
+	}
+	return redacted
+}
@@ -0,0 +1,50 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampler keeps the first Initial entries of a key per Tick and every Thereafter-th entry after them.
+// A nil sampler keeps everything.
+type Sampler struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+
+	mu      sync.Mutex
+	started time.Time
+	counts  map[string]int
+}
+
+func NewSampler(initial int, thereafter int) *Sampler {
+	return &Sampler{Initial: initial, Thereafter: thereafter, Tick: time.Second}
+}
+
+// Allow counts the entry and reports whether it should be logged.
+func (s *Sampler) Allow(key string) bool {
+	if s == nil || s.Initial <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tick := s.Tick
+	if tick <= 0 {
+		tick = time.Second
+	}
+
+	now := time.Now()
+	if s.counts == nil || now.Sub(s.started) >= tick {
+		s.counts = map[string]int{}
+		s.started = now
+	}
+
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.Initial {
+		return true
+	}
+	return s.Thereafter > 0 && (n-s.Initial)%s.Thereafter == 0
+}
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"log/slog"
+	"strings"
+)
+
+// SlogHandler writes log/slog records through a logrus logger with the fields of FromContext,
+// so code can move to slog while keeping the levels, redaction and outputs of AppLogger.
+type SlogHandler struct {
+	logger *logrus.Logger
+	attrs  logrus.Fields
+	groups []string
+}
+
+func NewSlogHandler(logger *logrus.Logger) *SlogHandler {
+	return &SlogHandler{logger: logger, attrs: logrus.Fields{}}
+}
+
+// Slog returns a slog logger of the component, see Component.
+func (l AppLogger) Slog(component string) *slog.Logger {
+	return slog.New(NewSlogHandler(l.Component(component)))
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.IsLevelEnabled(logrusLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := logrus.Fields{}
+	for k, v := range h.attrs {
+		fields[k] = v
+	}
+	record.Attrs(func(a slog.Attr) bool {
+		h.addAttr(fields, h.groups, a)
+		return true
+	})
+
+	entry := entryFromContext(h.logger, ctx).WithFields(fields)
+	entry.Time = record.Time
+	entry.Log(logrusLevel(record.Level), record.Message)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := h.clone()
+	for _, a := range attrs {
+		h.addAttr(clone.attrs, h.groups, a)
+	}
+	return clone
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := h.clone()
+	clone.groups = append(clone.groups, name)
+	return clone
+}
+
+func (h *SlogHandler) clone() *SlogHandler {
+	attrs := make(logrus.Fields, len(h.attrs))
+	for k, v := range h.attrs {
+		attrs[k] = v
+	}
+	return &SlogHandler{
+		logger: h.logger,
+		attrs:  attrs,
+		groups: append([]string{}, h.groups...),
+	}
+}
+
+// addAttr flattens groups into dotted keys like request.route.
+func (h *SlogHandler) addAttr(fields logrus.Fields, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			h.addAttr(fields, groups, ga)
+		}
+		return
+	}
+
+	key := a.Key
+	if len(groups) > 0 {
+		key = strings.Join(groups, ".") + "." + key
+	}
+	fields[key] = a.Value.Any()
+}
+
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	case level >= slog.LevelDebug:
+		return logrus.DebugLevel
+	}
+	return logrus.TraceLevel
+}
@@ -0,0 +1,118 @@
+package log
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	slowQueriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sdk_db_slow_queries_total",
+		Help: "Queries slower than the slow query threshold by operation and table.",
+	}, []string{"operation", "table"})
+
+	repeatedQueriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sdk_db_repeated_queries_total",
+		Help: "Requests repeating a statement at least DB_N_PLUS_ONE_THRESHOLD times by route.",
+	}, []string{"route"})
+)
+
+var (
+	// literals of the logged statement, replaced to compare statements repeated with other values
+	literalPattern = regexp.MustCompile(`'(?:[^']|'')*'|\b\d+(?:\.\d+)?\b`)
+	tablePattern   = regexp.MustCompile(`(?i)\b(?:from|into|update)\s+((?:"[^"]+"|\w+)(?:\.(?:"[^"]+"|\w+))?)`)
+)
+
+const explainTimeout = 5 * time.Second
+
+// configFromEnv reads DB_SLOW_QUERY_THRESHOLD, DB_SLOW_QUERY_EXPLAIN_RATE and DB_N_PLUS_ONE_THRESHOLD.
+func (l *GormLogger) configFromEnv() {
+	if d, err := time.ParseDuration(os.Getenv("DB_SLOW_QUERY_THRESHOLD")); err == nil {
+		l.SlowThreshold = d
+	}
+	if rate, err := strconv.ParseFloat(os.Getenv("DB_SLOW_QUERY_EXPLAIN_RATE"), 64); err == nil {
+		l.ExplainRate = rate
+	}
+	if n, err := strconv.Atoi(os.Getenv("DB_N_PLUS_ONE_THRESHOLD")); err == nil {
+		l.NPlusOneThreshold = n
+	}
+}
+
+// Name and Initialize register the logger as a gorm plugin with db.Use, plans of slow selects are
+// queried on the first db it is registered on and not on the connection of the query, which may be
+// a transaction in use by the request or already finished.
+func (l *GormLogger) Name() string {
+	return "sdk:log"
+}
+
+func (l *GormLogger) Initialize(db *gorm.DB) error {
+	l.db.CompareAndSwap(nil, db)
+	return nil
+}
+
+// observe counts slow queries, explains a sample of them and detects statements repeated within
+// one request, Trace calls it with the logged statement and the duration measured by gorm.
+func (l *GormLogger) observe(ctx context.Context, sql string, slow bool, source string) {
+	if strings.HasPrefix(sql, "EXPLAIN") {
+		return
+	}
+
+	if l.NPlusOneThreshold > 0 {
+		statement := literalPattern.ReplaceAllString(sql, "?")
+		if s := fieldsFrom(ctx); s != nil && s.countQuery(statement) == l.NPlusOneThreshold {
+			route, _ := s.get("route").(string)
+			repeatedQueriesTotal.WithLabelValues(route).Inc()
+			entryFromContext(l.logger, ctx).WithFields(logrus.Fields{
+				"source":  source,
+				"repeats": l.NPlusOneThreshold,
+			}).Warnf("possible N+1 query, statement repeated %d times in one request: %s", l.NPlusOneThreshold, statement)
+		}
+	}
+
+	if !slow {
+		return
+	}
+
+	operation, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+	operation = strings.ToLower(operation)
+	table := "unknown"
+	if m := tablePattern.FindStringSubmatch(sql); m != nil {
+		table = strings.ReplaceAll(m[1], `"`, "")
+	}
+	slowQueriesTotal.WithLabelValues(operation, table).Inc()
+
+	// redacted values can not be explained, the plan would contain them otherwise
+	if operation == "select" && l.ExplainRate > 0 && rand.Float64() < l.ExplainRate && !strings.Contains(sql, Redacted) {
+		if db := l.db.Load(); db != nil {
+			go l.explain(ctx, db, sql, source)
+		}
+	}
+}
+
+// explain logs the plan of a slow select.
+func (l *GormLogger) explain(ctx context.Context, db *gorm.DB, sql string, source string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), explainTimeout)
+	defer cancel()
+
+	var plan string
+	err := db.Session(&gorm.Session{Context: ctx, Logger: gormlogger.Discard}).
+		Raw("EXPLAIN (FORMAT JSON) " + sql).Row().Scan(&plan)
+
+	entry := entryFromContext(l.logger, ctx).WithField("source", source)
+	if err != nil {
+		entry.WithError(err).Warn("explain of slow query failed")
+		return
+	}
+
+	entry.WithField("plan", plan).Warnf("plan of slow query: %s", sql)
+}
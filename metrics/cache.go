@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rgglez/gormcache"
+	"time"
+)
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sdk_cache_requests_total",
+	Help: "Cache lookups by cache name and result (hit, miss or error).",
+}, []string{"cache", "result"})
+
+// CacheClient counts hits and misses of a gormcache client.
+type CacheClient struct {
+	name   string
+	client gormcache.CacheClient
+}
+
+func NewCacheClient(name string, client gormcache.CacheClient) *CacheClient {
+	return &CacheClient{name: name, client: client}
+}
+
+func (c *CacheClient) Get(ctx context.Context, key string) (interface{}, error) {
+	value, err := c.client.Get(ctx, key)
+
+	switch {
+	case err != nil:
+		cacheRequests.WithLabelValues(c.name, "error").Inc()
+	case value == nil:
+		cacheRequests.WithLabelValues(c.name, "miss").Inc()
+	default:
+		cacheRequests.WithLabelValues(c.name, "hit").Inc()
+	}
+
+	return value, err
+}
+
+func (c *CacheClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl)
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sdk_http_requests_total",
+		Help: "Handled HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sdk_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	inFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sdk_http_requests_in_flight",
+		Help: "HTTP requests currently being handled.",
+	})
+)
+
+// Middleware records rate, errors and duration of every route, labeled by c.FullPath()
+// so path parameters do not create new series.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		code := strconv.Itoa(c.Writer.Status())
+
+		requestsTotal.WithLabelValues(route, c.Request.Method, code).Inc()
+		requestDuration.WithLabelValues(route, c.Request.Method, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Serve exposes /metrics on a separate address, e.g. :9090, so it is not reachable through the public ingress.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.Println("Serving metrics on " + addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Println("Metrics server: " + err.Error())
+	}
+}
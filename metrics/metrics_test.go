@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/event/:id", func(c *gin.Context) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/event/1", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/event/2", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/unknown", nil))
+
+	if v := testutil.ToFloat64(requestsTotal.WithLabelValues("/event/:id", "GET", "200")); v != 2 {
+		t.Fatalf("Expected 2 requests of the route template, got %v", v)
+	}
+	if v := testutil.ToFloat64(requestsTotal.WithLabelValues("unmatched", "GET", "404")); v != 1 {
+		t.Fatalf("Expected 1 unmatched request, got %v", v)
+	}
+	if v := testutil.ToFloat64(inFlight); v != 0 {
+		t.Fatalf("Unexpected in flight requests %v", v)
+	}
+}
+
+type event struct {
+	ID int `gorm:"primaryKey"`
+}
+
+func TestGormPlugin(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(GormPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []event
+	db.Find(&events)
+
+	if n := testutil.CollectAndCount(queryDuration, "sdk_db_query_duration_seconds"); n != 1 {
+		t.Fatalf("Expected one series, got %d", n)
+	}
+}
+
+type fakeCache map[string]interface{}
+
+func (f fakeCache) Get(ctx context.Context, key string) (interface{}, error) {
+	return f[key], nil
+}
+
+func (f fakeCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	f[key] = value
+	return nil
+}
+
+func TestCacheClient(t *testing.T) {
+	c := NewCacheClient("test", fakeCache{})
+	c.Get(context.Background(), "a")
+	c.Set(context.Background(), "a", []byte("1"), time.Minute)
+	c.Get(context.Background(), "a")
+
+	if testutil.ToFloat64(cacheRequests.WithLabelValues("test", "hit")) != 1 || testutil.ToFloat64(cacheRequests.WithLabelValues("test", "miss")) != 1 {
+		t.Fatal("Unexpected cache counters")
+	}
+}
@@ -3,8 +3,10 @@ package models
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/gob"
 	"fmt"
+	"github.com/runetid/go-sdk/trace"
 	"log"
 	"net"
 )
@@ -13,6 +15,48 @@ type InternalRequest struct {
 	Host   string
 	Method string
 	Body   interface{}
+	// forwarded by NewInternalRequest, restore it on the server with Context
+	TraceId     string
+	TraceParent string
+}
+
+// NewInternalRequest carries the trace id of ctx to the internal server.
+func NewInternalRequest(ctx context.Context, host string, method string, body interface{}) *InternalRequest {
+	return &InternalRequest{
+		Host:        host,
+		Method:      method,
+		Body:        body,
+		TraceId:     trace.FromContext(ctx),
+		TraceParent: trace.SpanFromContext(ctx).Parent(),
+	}
+}
+
+// Context returns ctx with the trace id of the caller, or a new one for old clients.
+func (r *InternalRequest) Context(ctx context.Context) context.Context {
+	traceId := r.TraceId
+	if traceId == "" {
+		traceId = trace.New()
+	}
+	return trace.ContextWithParent(trace.NewContext(ctx, traceId), r.TraceParent)
+}
+
+// DecodeInternalRequest decodes a request sent by SockFetch.
+func DecodeInternalRequest(data []byte) (*InternalRequest, error) {
+	var req *InternalRequest
+	err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&req)
+	return req, err
+}
+
+// SockFetchContext is SockFetch within a client span, the request carries the trace of ctx.
+func SockFetchContext[T any](ctx context.Context, req *InternalRequest) (T, error) {
+	ctx, span := trace.StartSpan(ctx, "rpc "+req.Method, trace.KindClient)
+	defer span.Finish()
+	span.SetAttribute("rpc.system", "gob")
+	span.SetAttribute("net.peer.name", req.Host)
+
+	req.TraceId = trace.FromContext(ctx)
+	req.TraceParent = span.Parent()
+	return SockFetch[T](req)
 }
 
 type InternalResponse struct {
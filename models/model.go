@@ -7,6 +7,7 @@ import (
 type ApiAccountResponse struct {
 	Message string `json:"message"`
 	Data    struct {
+		Id      int64  `json:"id"`
 		Role    string `json:"role"`
 		EventId int64  `json:"event_id"`
 	} `json:"data"`
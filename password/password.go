@@ -0,0 +1,216 @@
+package password
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+var ErrUnknownFormat = errors.New("password: unknown hash format")
+
+// Limits of the argon2id params read from stored hashes, so a crafted hash can not
+// make Verify allocate unbounded memory or spin, exceeding hashes are unknown.
+var (
+	MaxMemory      uint32 = 1024 * 1024
+	MaxIterations  uint32 = 64
+	MaxParallelism uint8  = 16
+)
+
+type Algorithm string
+
+const (
+	Argon2id Algorithm = "argon2id"
+	Bcrypt   Algorithm = "bcrypt"
+)
+
+// Params of newly created hashes, hashes with weaker params need a rehash.
+type Params struct {
+	Algorithm Algorithm
+	// argon2id memory in KiB, iterations and parallelism
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+	BcryptCost  int
+}
+
+func DefaultParams() Params {
+	return Params{
+		Algorithm:   Argon2id,
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+		BcryptCost:  bcrypt.DefaultCost,
+	}
+}
+
+type Hasher struct {
+	params Params
+}
+
+// NewHasher creates a hasher, zero params are replaced with DefaultParams.
+func NewHasher(params Params) *Hasher {
+	defaults := DefaultParams()
+	if params.Algorithm == "" {
+		params.Algorithm = defaults.Algorithm
+	}
+	if params.Memory == 0 {
+		params.Memory = defaults.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = defaults.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = defaults.Parallelism
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = defaults.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = defaults.KeyLength
+	}
+	if params.BcryptCost == 0 {
+		params.BcryptCost = defaults.BcryptCost
+	}
+	return &Hasher{params: params}
+}
+
+var defaultHasher = NewHasher(DefaultParams())
+
+// Hash hashes the password with the default argon2id params.
+func Hash(password string) (string, error) {
+	return defaultHasher.Hash(password)
+}
+
+// Verify compares the password with an argon2id, bcrypt or legacy md5 hash in constant time.
+func Verify(password string, encoded string) (bool, error) {
+	return defaultHasher.Verify(password, encoded)
+}
+
+// NeedsRehash reports whether the hash should be replaced after a successful login.
+func NeedsRehash(encoded string) bool {
+	return defaultHasher.NeedsRehash(encoded)
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.params.Algorithm == Bcrypt {
+		b, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+		return string(b), err
+	}
+
+	salt, err := randomBytes(int(h.params.SaltLength))
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Hasher) Verify(password string, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case isLegacyMD5(encoded):
+		sum := md5.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(encoded))) == 1, nil
+	}
+
+	return false, ErrUnknownFormat
+}
+
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		if h.params.Algorithm != Argon2id {
+			return true
+		}
+		p, _, key, err := decodeArgon2id(encoded)
+		return err != nil ||
+			p.Memory < h.params.Memory ||
+			p.Iterations < h.params.Iterations ||
+			p.Parallelism < h.params.Parallelism ||
+			uint32(len(key)) < h.params.KeyLength
+	case isBcrypt(encoded):
+		if h.params.Algorithm != Bcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost < h.params.BcryptCost
+	}
+
+	return true
+}
+
+func decodeArgon2id(encoded string) (Params, []byte, []byte, error) {
+	var p Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownFormat
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	if p.Memory == 0 || p.Memory > MaxMemory || p.Iterations == 0 || p.Iterations > MaxIterations ||
+		p.Parallelism == 0 || p.Parallelism > MaxParallelism {
+		return p, nil, nil, ErrUnknownFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownFormat
+	}
+
+	p.Algorithm = Argon2id
+	return p, salt, key, nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// isLegacyMD5 matches hashes created by sdk.GetPasswordHash.
+func isLegacyMD5(encoded string) bool {
+	if len(encoded) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
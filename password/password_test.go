@@ -0,0 +1,84 @@
+package password
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hasher := NewHasher(Params{Algorithm: Argon2id, Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+
+	hash, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("Unexpected hash %s", hash)
+	}
+
+	if ok, err := hasher.Verify("secret", hash); !ok || err != nil {
+		t.Fatalf("Expected password to match, got %v %v", ok, err)
+	}
+	if ok, _ := hasher.Verify("wrong", hash); ok {
+		t.Fatal("Expected wrong password to fail")
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Fatal("Expected fresh hash not to need a rehash")
+	}
+	if !NeedsRehash(hash) {
+		t.Fatal("Expected weak params to need a rehash")
+	}
+
+	b, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if ok, err := Verify("secret", string(b)); !ok || err != nil {
+		t.Fatalf("Expected bcrypt hash to match, got %v %v", ok, err)
+	}
+
+	if _, err := Verify("secret", "plain"); err != ErrUnknownFormat {
+		t.Fatalf("Expected unknown format, got %v", err)
+	}
+
+	for _, params := range []string{"m=1024,t=1,p=0", "m=4294967295,t=1,p=1", "m=1024,t=100000,p=1"} {
+		crafted := strings.Replace(hash, "m=1024,t=1,p=1", params, 1)
+		if _, err := hasher.Verify("secret", crafted); err != ErrUnknownFormat {
+			t.Fatalf("Expected %s to be rejected, got %v", params, err)
+		}
+	}
+}
+
+func TestZeroParams(t *testing.T) {
+	hash, err := NewHasher(Params{Memory: 1024}).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=3,p=2$") {
+		t.Fatalf("Zero params not defaulted: %s", hash)
+	}
+}
+
+func TestLegacyMD5(t *testing.T) {
+	legacy := "5ebe2294ecd0e0f08eab7690d2a6ee69" // md5("secret")
+
+	if ok, err := Verify("secret", legacy); !ok || err != nil {
+		t.Fatalf("Expected legacy hash to match, got %v %v", ok, err)
+	}
+	if ok, _ := Verify("wrong", legacy); ok {
+		t.Fatal("Expected wrong password to fail")
+	}
+	if !NeedsRehash(legacy) {
+		t.Fatal("Expected legacy hash to need a rehash")
+	}
+}
+
+func TestRandom(t *testing.T) {
+	s, err := RandomString(32)
+	if err != nil || len(s) != 32 {
+		t.Fatalf("Unexpected string %q %v", s, err)
+	}
+
+	token, err := Token(32)
+	if err != nil || len(token) != 43 {
+		t.Fatalf("Unexpected token %q %v", token, err)
+	}
+}
@@ -0,0 +1,45 @@
+package password
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+)
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Token returns n random bytes encoded with url safe base64, e.g. for api secrets.
+func Token(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RandomString returns n uniformly distributed letters and digits, e.g. for api keys.
+func RandomString(n int) (string, error) {
+	return RandomFrom(letters, n)
+}
+
+// RandomFrom picks n characters of the alphabet with crypto/rand.
+func RandomFrom(alphabet string, n int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, n)
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[idx.Int64()]
+	}
+	return string(b), nil
+}
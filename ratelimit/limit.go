@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+type Algorithm string
+
+const (
+	// SlidingWindow weights the count of the previous window by its overlap with the sliding window.
+	SlidingWindow Algorithm = "sliding_window"
+	// TokenBucket refills Requests tokens per Window up to Burst and allows short bursts.
+	TokenBucket Algorithm = "token_bucket"
+)
+
+type Limit struct {
+	Requests  int
+	Window    time.Duration
+	Algorithm Algorithm
+	// bucket size of TokenBucket, defaults to Requests
+	Burst int
+}
+
+func PerSecond(n int) Limit {
+	return Limit{Requests: n, Window: time.Second, Algorithm: SlidingWindow}
+}
+
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Window: time.Minute, Algorithm: SlidingWindow}
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// Result of taking a request from a limit.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// until the limit is fully available again
+	Reset time.Duration
+	// until the next request is allowed, set for rejected requests
+	RetryAfter time.Duration
+}
+
+// Store counts requests per key, e.g. in memory of a single replica or in memcached.
+type Store interface {
+	Take(key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	Tokens float64
+	Last   int64
+}
+
+func takeToken(b bucket, l Limit, now time.Time) (bucket, Result) {
+	capacity := float64(l.burst())
+	rate := float64(l.Requests) / l.Window.Seconds()
+
+	if b.Last == 0 {
+		b.Tokens = capacity
+	} else if elapsed := now.Sub(time.Unix(0, b.Last)).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(capacity, b.Tokens+elapsed*rate)
+	}
+	b.Last = now.UnixNano()
+
+	r := Result{Limit: l.burst()}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = seconds((1 - b.Tokens) / rate)
+	}
+
+	r.Remaining = int(b.Tokens)
+	r.Reset = seconds((capacity - b.Tokens) / rate)
+	return b, r
+}
+
+// slide decides on a request in the window started at start with counts of the previous and current windows.
+func slide(prev int, curr int, start time.Time, l Limit, now time.Time) Result {
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(l.Window)
+	count := float64(prev)*weight + float64(curr)
+
+	r := Result{Limit: l.Requests, Reset: l.Window - elapsed}
+	if count+1 <= float64(l.Requests) {
+		r.Allowed = true
+		r.Remaining = int(float64(l.Requests) - count - 1)
+		return r
+	}
+
+	if curr >= l.Requests || prev == 0 {
+		// only the next window helps
+		r.RetryAfter = l.Window - elapsed
+	} else {
+		// the previous window has to lose enough weight
+		free := 1 - float64(l.Requests-curr-1)/float64(prev)
+		r.RetryAfter = time.Duration(free*float64(l.Window)) - elapsed
+	}
+	if r.RetryAfter < time.Second {
+		r.RetryAfter = time.Second
+	}
+	return r
+}
+
+func windowStart(l Limit, now time.Time) (int64, time.Time) {
+	index := now.UnixNano() / int64(l.Window)
+	return index, time.Unix(0, index*int64(l.Window))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/bradfitz/gomemcache/memcache"
+	"strconv"
+	"time"
+)
+
+var ErrConflict = errors.New("ratelimit: too many concurrent updates")
+
+// MemcacheStore shares the counters between replicas, usually on the CACHE_SRV connection.
+type MemcacheStore struct {
+	client *memcache.Client
+	prefix string
+}
+
+func NewMemcacheStore(client *memcache.Client) *MemcacheStore {
+	return &MemcacheStore{client: client, prefix: "ratelimit:"}
+}
+
+func (s *MemcacheStore) Take(key string, limit Limit) (Result, error) {
+	sum := sha256.Sum256([]byte(key))
+	key = s.prefix + hex.EncodeToString(sum[:])
+
+	if limit.Algorithm == TokenBucket {
+		return s.takeToken(key, limit)
+	}
+	return s.slide(key, limit)
+}
+
+func (s *MemcacheStore) takeToken(key string, limit Limit) (Result, error) {
+	for i := 0; i < 5; i++ {
+		item, err := s.client.Get(key)
+		if err != nil && err != memcache.ErrCacheMiss {
+			return Result{}, err
+		}
+
+		var b bucket
+		if item != nil {
+			json.Unmarshal(item.Value, &b)
+		}
+
+		b, r := takeToken(b, limit, time.Now())
+		value, _ := json.Marshal(b)
+		expiration := expiration(r.Reset)
+
+		if item == nil {
+			err = s.client.Add(&memcache.Item{Key: key, Value: value, Expiration: expiration})
+		} else {
+			item.Value = value
+			item.Expiration = expiration
+			err = s.client.CompareAndSwap(item)
+		}
+
+		switch err {
+		case nil:
+			return r, nil
+		case memcache.ErrNotStored, memcache.ErrCASConflict, memcache.ErrCacheMiss:
+			// another replica updated the bucket
+			continue
+		default:
+			return Result{}, err
+		}
+	}
+
+	return Result{}, ErrConflict
+}
+
+func (s *MemcacheStore) slide(key string, limit Limit) (Result, error) {
+	now := time.Now()
+	index, start := windowStart(limit, now)
+	curr := key + ":" + strconv.FormatInt(index, 10)
+	prev := key + ":" + strconv.FormatInt(index-1, 10)
+
+	items, err := s.client.GetMulti([]string{prev, curr})
+	if err != nil {
+		return Result{}, err
+	}
+
+	r := slide(count(items[prev]), count(items[curr]), start, limit, now)
+	if !r.Allowed {
+		return r, nil
+	}
+
+	if _, err := s.client.Increment(curr, 1); err == memcache.ErrCacheMiss {
+		err = s.client.Add(&memcache.Item{Key: curr, Value: []byte("1"), Expiration: expiration(2 * limit.Window)})
+		if err == memcache.ErrNotStored {
+			_, err = s.client.Increment(curr, 1)
+		}
+		if err != nil {
+			return r, err
+		}
+	} else if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func count(item *memcache.Item) int {
+	if item == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(item.Value))
+	return n
+}
+
+func expiration(d time.Duration) int32 {
+	return int32(d/time.Second) + 1
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	bucket bucket
+	// sliding window counters
+	index   int64
+	prev    int
+	curr    int
+	expires time.Time
+}
+
+// MemoryStore keeps the counters of a single replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	cleaned time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]entry{}, cleaned: time.Now()}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.clean(now)
+
+	e := s.entries[key]
+
+	if limit.Algorithm == TokenBucket {
+		var r Result
+		e.bucket, r = takeToken(e.bucket, limit, now)
+		// a full bucket is the same as a missing one
+		e.expires = now.Add(r.Reset)
+		s.entries[key] = e
+		return r, nil
+	}
+
+	index, start := windowStart(limit, now)
+	switch {
+	case e.index == index-1:
+		e = entry{index: index, prev: e.curr}
+	case e.index != index:
+		e = entry{index: index}
+	}
+
+	r := slide(e.prev, e.curr, start, limit, now)
+	if r.Allowed {
+		e.curr++
+	}
+	e.expires = start.Add(2 * limit.Window)
+	s.entries[key] = e
+	return r, nil
+}
+
+// clean drops expired counters, at most once a minute.
+func (s *MemoryStore) clean(now time.Time) {
+	if now.Sub(s.cleaned) < time.Minute {
+		return
+	}
+	s.cleaned = now
+
+	for key, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
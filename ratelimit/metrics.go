@@ -0,0 +1,18 @@
+package ratelimit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sdk_ratelimit_rejected_total",
+		Help: "Requests rejected by the rate limiter by route.",
+	}, []string{"route"})
+
+	errorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sdk_ratelimit_store_errors_total",
+		Help: "Failed rate limit store calls, the requests are allowed.",
+	})
+)
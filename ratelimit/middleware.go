@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyFunc returns the client of a request, an empty key leaves the request to the next KeyFunc.
+type KeyFunc func(c *gin.Context) string
+
+// ByApiKey limits integrations by the api key verified by AccountMiddleware, which has to run before.
+// The unverified header is ignored, random keys would get a fresh counter each.
+func ByApiKey(c *gin.Context) string {
+	if key := c.GetString("api_key"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:])
+	}
+	return ""
+}
+
+// ByUser limits authenticated users, UserMiddleware has to run before.
+func ByUser(c *gin.Context) string {
+	if u, ok := c.Get("user"); ok {
+		switch u := u.(type) {
+		case models.User:
+			return "user:" + strconv.Itoa(u.Id)
+		case *models.User:
+			return "user:" + strconv.Itoa(u.Id)
+		}
+	}
+	return ""
+}
+
+// ByIP limits clients by the address resolved with the trusted proxies of the router.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// First uses the first non empty key.
+func First(keys ...KeyFunc) KeyFunc {
+	return func(c *gin.Context) string {
+		for _, key := range keys {
+			if k := key(c); k != "" {
+				return k
+			}
+		}
+		return ""
+	}
+}
+
+type Config struct {
+	Store Store
+	// defaults to the api key, then the user, then the client IP
+	Key   KeyFunc
+	Limit Limit
+	// limits of routes with separate counters by gin path, e.g. "/apiaccount/list" or "GET /apiaccount/list"
+	Routes map[string]Limit
+	// requests which are never limited
+	Skip func(c *gin.Context) bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Store: NewMemoryStore(),
+		Key:   First(ByApiKey, ByUser, ByIP),
+		Limit: PerMinute(600),
+	}
+}
+
+// Middleware rejects requests over the limit with 429 and reports the limit in RateLimit-* headers.
+func Middleware(config Config) gin.HandlerFunc {
+	defaults := DefaultConfig()
+	if config.Store == nil {
+		config.Store = defaults.Store
+	}
+	if config.Key == nil {
+		config.Key = defaults.Key
+	}
+
+	return func(c *gin.Context) {
+		if config.Skip != nil && config.Skip(c) {
+			c.Next()
+			return
+		}
+
+		key := config.Key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		limit := config.Limit
+		if l, ok := config.Routes[c.Request.Method+" "+route]; ok {
+			limit, key = l, key+"|"+c.Request.Method+" "+route
+		} else if l, ok := config.Routes[route]; ok {
+			limit, key = l, key+"|"+route
+		}
+
+		if limit.Requests <= 0 || limit.Window <= 0 {
+			c.Next()
+			return
+		}
+
+		r, err := config.Store.Take(key, limit)
+		if err != nil {
+			// an unavailable store must not take the service down
+			errorsTotal.Inc()
+			log.Println("Rate limit: " + err.Error() + " traceId " + c.GetString("traceId"))
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(r.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(int((r.Reset+time.Second-1)/time.Second)))
+
+		if !r.Allowed {
+			rejectedTotal.WithLabelValues(route).Inc()
+			header.Set("Retry-After", strconv.Itoa(int((r.RetryAfter+time.Second-1)/time.Second)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests"})
+			c.Writer.WriteHeaderNow()
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	limit := Limit{Requests: 1, Window: time.Second, Burst: 3, Algorithm: TokenBucket}
+	now := time.Now()
+
+	var b bucket
+	var r Result
+	for i := 0; i < 3; i++ {
+		if b, r = takeToken(b, limit, now); !r.Allowed {
+			t.Fatalf("Request %d rejected", i)
+		}
+	}
+
+	if b, r = takeToken(b, limit, now); r.Allowed || r.RetryAfter != time.Second {
+		t.Fatalf("Expected rejection with retry after 1s, got %+v", r)
+	}
+
+	if _, r = takeToken(b, limit, now.Add(time.Second)); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("Expected refilled token, got %+v", r)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	limit := PerMinute(10)
+	start := time.Unix(600, 0)
+
+	if r := slide(0, 9, start, limit, start.Add(30*time.Second)); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("Expected last request allowed, got %+v", r)
+	}
+
+	// half of the previous window still counts
+	r := slide(10, 5, start, limit, start.Add(30*time.Second))
+	if r.Allowed || r.RetryAfter != 6*time.Second {
+		t.Fatalf("Expected rejection, got %+v", r)
+	}
+
+	if r := slide(10, 5, start, limit, start.Add(45*time.Second)); !r.Allowed {
+		t.Fatalf("Expected request allowed, got %+v", r)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// keys are verified by AccountMiddleware, a "-" key is rejected
+	r.Use(func(c *gin.Context) {
+		if key := c.Request.Header.Get("ApiKey"); key != "-" {
+			c.Set("api_key", key)
+		}
+	})
+	r.Use(Middleware(Config{
+		Limit:  PerMinute(100),
+		Routes: map[string]Limit{"GET /apiaccount/list": PerMinute(2)},
+	}))
+	r.GET("/apiaccount/list", func(c *gin.Context) {})
+	r.GET("/apiaccount/:id", func(c *gin.Context) {})
+
+	request := func(path string, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("ApiKey", key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("/apiaccount/list", "a"); w.Code != 200 || w.Header().Get("RateLimit-Limit") != "2" {
+			t.Fatalf("Request %d rejected: %d", i, w.Code)
+		}
+	}
+
+	w := request("/apiaccount/list", "a")
+	if w.Code != 429 || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+
+	if w := request("/apiaccount/list", "b"); w.Code != 200 {
+		t.Fatal("Limit shared between api keys")
+	}
+	if w := request("/apiaccount/1", "a"); w.Code != 200 || w.Header().Get("RateLimit-Remaining") != "99" {
+		t.Fatalf("Route limit applied to other routes: %d %v", w.Code, w.Header())
+	}
+	if w := request("/apiaccount/1", "-"); w.Code != 200 || w.Header().Get("RateLimit-Remaining") != "99" {
+		t.Fatalf("Unverified key not limited by address: %d %v", w.Code, w.Header())
+	}
+	if w := request("/apiaccount/1", "-"); w.Header().Get("RateLimit-Remaining") != "98" {
+		t.Fatal("Unverified keys counted separately")
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"github.com/gin-gonic/gin"
-	"math/rand"
+	"github.com/runetid/go-sdk/password"
 )
 
+// Deprecated: unsalted md5, use password.Hash and password.Verify.
+// Existing hashes are accepted by password.Verify and reported by password.NeedsRehash.
 func GetPasswordHash(password string) string {
 	hashes := md5.New()
 	hashes.Write([]byte(password))
@@ -15,11 +17,11 @@ func GetPasswordHash(password string) string {
 
 func RandString(n int) string {
 	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letterBytes[rand.Int63()%int64(len(letterBytes))]
+	s, err := password.RandomFrom(letterBytes, n)
+	if err != nil {
+		panic(err)
 	}
-	return string(b)
+	return s
 }
 
 func AccessMiddleware() gin.HandlerFunc {
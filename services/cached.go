@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/runetid/go-sdk/cache"
+	"github.com/runetid/go-sdk/httpclient"
+	"github.com/runetid/go-sdk/models"
+	"strconv"
+	"time"
+)
+
+type CacheConfig struct {
+	TTL time.Duration
+	// time to remember unknown tokens, api keys and events, 0 disables negative caching
+	NegativeTTL time.Duration
+}
+
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		TTL:         time.Minute,
+		NegativeTTL: 10 * time.Second,
+	}
+}
+
+// hashKey keeps tokens out of cache keys and within the memcached key limits.
+func hashKey(prefix string, parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return prefix + hex.EncodeToString(h.Sum(nil))
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, httpclient.ErrNotFound)
+}
+
+func isUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+type CachedAccountClient struct {
+	inner  AccountClient
+	cache  cache.Cache
+	ttl    time.Duration
+	loader *cache.Loader[models.ApiAccountResponse]
+}
+
+func NewCachedAccountClient(inner AccountClient, c cache.Cache, config CacheConfig) *CachedAccountClient {
+	ttl := config.TTL
+	if config.NegativeTTL > ttl {
+		ttl = config.NegativeTTL
+	}
+
+	return &CachedAccountClient{
+		inner: inner,
+		cache: c,
+		ttl:   ttl,
+		loader: &cache.Loader[models.ApiAccountResponse]{
+			Cache:       c,
+			TTL:         config.TTL,
+			NegativeTTL: config.NegativeTTL,
+			Negative:    isUnauthorized,
+			NegativeErr: ErrUnauthorized,
+		},
+	}
+}
+
+// Check caches checks of unsigned requests by api key and origin. Signed checks are passed through,
+// their hash changes with the time, so cached results would never be reused.
+func (a *CachedAccountClient) Check(ctx context.Context, check AccountCheck) (models.ApiAccountResponse, error) {
+	if check.Hash != "" || check.Time != "" {
+		return a.inner.Check(ctx, check)
+	}
+
+	key := hashKey("account:check:", check.ApiKey, a.generation(check.ApiKey), check.Origin)
+	return a.loader.Load(key, func() (models.ApiAccountResponse, error) {
+		return a.inner.Check(ctx, check)
+	})
+}
+
+// generation is part of the check keys of an api key, InvalidateKey changes it to drop
+// the checks of every origin. It outlives the cached checks it replaces.
+func (a *CachedAccountClient) generation(key string) string {
+	b, _ := a.cache.Get(hashKey("account:generation:", key))
+	return string(b)
+}
+
+func (a *CachedAccountClient) ByKey(ctx context.Context, key string) (models.ApiAccountResponse, error) {
+	return a.loader.Load(hashKey("account:key:", key), func() (models.ApiAccountResponse, error) {
+		return a.inner.ByKey(ctx, key)
+	})
+}
+
+// InvalidateKey drops the cached account and checks of the api key, e.g. when it is blocked.
+func (a *CachedAccountClient) InvalidateKey(key string) {
+	a.loader.Invalidate(hashKey("account:key:", key))
+	a.cache.Set(hashKey("account:generation:", key), []byte(strconv.FormatInt(time.Now().UnixNano(), 36)), a.ttl)
+}
+
+type CachedUserClient struct {
+	inner  UserClient
+	users  *cache.Loader[models.User]
+	grants *cache.Loader[bool]
+}
+
+func NewCachedUserClient(inner UserClient, c cache.Cache, config CacheConfig) *CachedUserClient {
+	return &CachedUserClient{
+		inner: inner,
+		users: &cache.Loader[models.User]{
+			Cache:       c,
+			TTL:         config.TTL,
+			NegativeTTL: config.NegativeTTL,
+			Negative:    isNotFound,
+			NegativeErr: httpclient.ErrNotFound,
+		},
+		grants: &cache.Loader[bool]{
+			Cache: c,
+			TTL:   config.TTL,
+		},
+	}
+}
+
+func (u *CachedUserClient) ByToken(ctx context.Context, token string) (models.User, error) {
+	return u.users.Load(hashKey("user:token:", token), func() (models.User, error) {
+		return u.inner.ByToken(ctx, token)
+	})
+}
+
+func (u *CachedUserClient) Can(ctx context.Context, token string, role string) (bool, error) {
+	return u.grants.Load(hashKey("user:can:", token, role), func() (bool, error) {
+		return u.inner.Can(ctx, token, role)
+	})
+}
+
+// InvalidateToken drops the cached user and the listed role checks of the token, e.g. on logout.
+func (u *CachedUserClient) InvalidateToken(token string, roles ...string) {
+	u.users.Invalidate(hashKey("user:token:", token))
+	for _, role := range roles {
+		u.grants.Invalidate(hashKey("user:can:", token, role))
+	}
+}
+
+type CachedEventClient struct {
+	inner  EventClient
+	loader *cache.Loader[models.Event]
+}
+
+func NewCachedEventClient(inner EventClient, c cache.Cache, config CacheConfig) *CachedEventClient {
+	return &CachedEventClient{
+		inner: inner,
+		loader: &cache.Loader[models.Event]{
+			Cache:       c,
+			TTL:         config.TTL,
+			NegativeTTL: config.NegativeTTL,
+			Negative:    isNotFound,
+			NegativeErr: httpclient.ErrNotFound,
+		},
+	}
+}
+
+func (e *CachedEventClient) Get(ctx context.Context, id int64) (models.Event, error) {
+	return e.loader.Load("event:"+strconv.FormatInt(id, 10), func() (models.Event, error) {
+		return e.inner.Get(ctx, id)
+	})
+}
+
+func (e *CachedEventClient) Invalidate(id int64) {
+	e.loader.Invalidate("event:" + strconv.FormatInt(id, 10))
+}
+
+// EnableCache wraps the default Accounts, Users and Events clients with caching.
+func EnableCache(c cache.Cache, config CacheConfig) {
+	Accounts = NewCachedAccountClient(Accounts, c, config)
+	Users = NewCachedUserClient(Users, c, config)
+	Events = NewCachedEventClient(Events, c, config)
+}
+
+// Invalidate drops the cached lookups of the default clients, arguments may be empty.
+func Invalidate(token string, apiKey string, eventId int64) {
+	if u, ok := Users.(*CachedUserClient); ok && token != "" {
+		u.InvalidateToken(token)
+	}
+	if a, ok := Accounts.(*CachedAccountClient); ok && apiKey != "" {
+		a.InvalidateKey(apiKey)
+	}
+	if e, ok := Events.(*CachedEventClient); ok && eventId != 0 {
+		e.Invalidate(eventId)
+	}
+}
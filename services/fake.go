@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"github.com/runetid/go-sdk/httpclient"
+	"github.com/runetid/go-sdk/models"
+	"sync"
+)
+
+// FakeAccountClient is an in-memory AccountClient for unit tests, accounts are keyed by api key.
+type FakeAccountClient struct {
+	mu       sync.Mutex
+	Accounts map[string]models.ApiAccountResponse
+	Calls    int
+}
+
+func (f *FakeAccountClient) Check(ctx context.Context, check AccountCheck) (models.ApiAccountResponse, error) {
+	return f.ByKey(ctx, check.ApiKey)
+}
+
+func (f *FakeAccountClient) ByKey(ctx context.Context, key string) (models.ApiAccountResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls++
+	if a, ok := f.Accounts[key]; ok {
+		return a, nil
+	}
+	return models.ApiAccountResponse{}, ErrUnauthorized
+}
+
+// FakeUserClient is an in-memory UserClient for unit tests, users and roles are keyed by token.
+type FakeUserClient struct {
+	mu    sync.Mutex
+	Users map[string]models.User
+	Roles map[string][]string
+	Calls int
+}
+
+func (f *FakeUserClient) ByToken(ctx context.Context, token string) (models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls++
+	if u, ok := f.Users[token]; ok {
+		return u, nil
+	}
+	return models.User{}, httpclient.ErrNotFound
+}
+
+func (f *FakeUserClient) Can(ctx context.Context, token string, role string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls++
+	for _, r := range f.Roles[token] {
+		if r == role {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FakeEventClient is an in-memory EventClient for unit tests.
+type FakeEventClient struct {
+	mu     sync.Mutex
+	Events map[int64]models.Event
+	Calls  int
+}
+
+func (f *FakeEventClient) Get(ctx context.Context, id int64) (models.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls++
+	if e, ok := f.Events[id]; ok {
+		return e, nil
+	}
+	return models.Event{}, httpclient.ErrNotFound
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/runetid/go-sdk/httpclient"
+	"github.com/runetid/go-sdk/models"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// AccountCheck holds the signature headers of a request authenticated by api key.
+type AccountCheck struct {
+	ApiKey string
+	Hash   string
+	Time   string
+	Origin string
+}
+
+type AccountClient interface {
+	// Check validates the api key signature, it returns an error wrapping ErrUnauthorized for rejected keys.
+	Check(ctx context.Context, check AccountCheck) (models.ApiAccountResponse, error)
+	ByKey(ctx context.Context, key string) (models.ApiAccountResponse, error)
+}
+
+type UserClient interface {
+	ByToken(ctx context.Context, token string) (models.User, error)
+	// Can reports whether the user owning the token has the role.
+	Can(ctx context.Context, token string, role string) (bool, error)
+}
+
+type EventClient interface {
+	Get(ctx context.Context, id int64) (models.Event, error)
+}
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Default clients used by the sdk middlewares, replace them with fakes in tests.
+var (
+	Accounts AccountClient = NewAccountClient(nil)
+	Users    UserClient    = NewUserClient(nil)
+	Events   EventClient   = NewEventClient(nil)
+)
+
+// serviceHeader authenticates the service with SERVICE_TOKEN, the trace id is forwarded by httpclient.
+func serviceHeader() http.Header {
+	header := http.Header{}
+	if token := os.Getenv("SERVICE_TOKEN"); token != "" {
+		header.Set("X-Service-Token", token)
+	}
+	return header
+}
+
+func unauthorized(err error) error {
+	if code := httpclient.StatusCode(err); code == http.StatusUnauthorized || code == http.StatusForbidden {
+		return errors.Join(ErrUnauthorized, err)
+	}
+	return err
+}
+
+type accountClient struct {
+	client *httpclient.Client
+}
+
+// NewAccountClient creates a client of the account service, nil uses the shared client on DNS_ACCOUNT.
+func NewAccountClient(client *httpclient.Client) AccountClient {
+	return &accountClient{client: client}
+}
+
+func (a *accountClient) http() *httpclient.Client {
+	if a.client != nil {
+		return a.client
+	}
+	return httpclient.Service("account")
+}
+
+func (a *accountClient) Check(ctx context.Context, check AccountCheck) (models.ApiAccountResponse, error) {
+	q := url.Values{}
+	q.Add("ApiKey", check.ApiKey)
+	q.Add("Hash", check.Hash)
+	q.Add("Time", check.Time)
+	q.Add("Origin", check.Origin)
+
+	res, err := httpclient.FetchJSON[models.ApiAccountResponse](ctx, a.http(), http.MethodGet, "/apiaccount/check?"+q.Encode(), nil, serviceHeader())
+	return res, unauthorized(err)
+}
+
+func (a *accountClient) ByKey(ctx context.Context, key string) (models.ApiAccountResponse, error) {
+	res, err := httpclient.FetchJSON[models.ApiAccountResponse](ctx, a.http(), http.MethodGet, "/apiaccount/check/"+url.PathEscape(key), nil, serviceHeader())
+	return res, unauthorized(err)
+}
+
+type userClient struct {
+	client *httpclient.Client
+}
+
+// NewUserClient creates a client of the user service, nil uses the shared clients of the
+// endpoints: token lookups go to DNS_USER, role checks to DNS_USERS.
+func NewUserClient(client *httpclient.Client) UserClient {
+	return &userClient{client: client}
+}
+
+func (u *userClient) http(service string) *httpclient.Client {
+	if u.client != nil {
+		return u.client
+	}
+	return httpclient.Service(service)
+}
+
+func (u *userClient) ByToken(ctx context.Context, token string) (models.User, error) {
+	return httpclient.Fetch[models.User](ctx, u.http("user"), http.MethodGet, "/internal/byToken/"+url.PathEscape(token), nil, serviceHeader())
+}
+
+func (u *userClient) Can(ctx context.Context, token string, role string) (bool, error) {
+	res, err := u.http("users").Do(ctx, http.MethodGet, "/user/can/"+url.PathEscape(token)+"/"+url.PathEscape(role), nil, serviceHeader())
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+		return true, nil
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		return false, nil
+	}
+
+	return false, &httpclient.Error{Service: "users", Method: http.MethodGet, Url: res.Request.URL.String(), StatusCode: res.StatusCode}
+}
+
+type eventClient struct {
+	client *httpclient.Client
+}
+
+// NewEventClient creates a client of the event service, nil uses the shared client on DNS_EVENT.
+func NewEventClient(client *httpclient.Client) EventClient {
+	return &eventClient{client: client}
+}
+
+func (e *eventClient) http() *httpclient.Client {
+	if e.client != nil {
+		return e.client
+	}
+	return httpclient.Service("event")
+}
+
+func (e *eventClient) Get(ctx context.Context, id int64) (models.Event, error) {
+	return httpclient.Fetch[models.Event](ctx, e.http(), http.MethodGet, "/event/"+strconv.FormatInt(id, 10), nil, serviceHeader())
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/runetid/go-sdk/cache"
+	"github.com/runetid/go-sdk/httpclient"
+	"github.com/runetid/go-sdk/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestAccountCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ApiKey") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"Message": "Unauthorized"}`))
+			return
+		}
+		w.Write([]byte(`{"message": "ok", "data": {"role": "admin", "event_id": 7}}`))
+	}))
+	defer srv.Close()
+
+	client := NewAccountClient(httpclient.New(httpclient.DefaultConfig("account", srv.URL)))
+
+	res, err := client.Check(context.Background(), AccountCheck{ApiKey: "key"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Data.EventId != 7 || res.Data.Role != "admin" {
+		t.Fatalf("Unexpected account %+v", res)
+	}
+
+	_, err = client.Check(context.Background(), AccountCheck{ApiKey: "wrong"})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Expected unauthorized error, got %v", err)
+	}
+}
+
+func TestUserCan(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user/can/token/admin" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewUserClient(httpclient.New(httpclient.DefaultConfig("users", srv.URL)))
+
+	if can, err := client.Can(context.Background(), "token", "admin"); !can || err != nil {
+		t.Fatalf("Expected permission, got %v %v", can, err)
+	}
+
+	if can, err := client.Can(context.Background(), "token", "manager"); can || err != nil {
+		t.Fatalf("Expected denial, got %v %v", can, err)
+	}
+}
+
+func TestUserEndpointHosts(t *testing.T) {
+	byToken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"id":66427}}`))
+	}))
+	defer byToken.Close()
+	can := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer can.Close()
+	t.Setenv("DNS_USER", byToken.URL)
+	t.Setenv("DNS_USERS", can.URL)
+
+	client := NewUserClient(nil)
+	if u, err := client.ByToken(context.Background(), "token"); err != nil || u.Id != 66427 {
+		t.Fatalf("Token not looked up on DNS_USER: %+v %v", u, err)
+	}
+	if ok, err := client.Can(context.Background(), "token", "admin"); !ok || err != nil {
+		t.Fatalf("Role not checked on DNS_USERS: %v %v", ok, err)
+	}
+}
+
+type countingAccounts struct {
+	checks int
+	role   string
+}
+
+func (a *countingAccounts) Check(ctx context.Context, check AccountCheck) (models.ApiAccountResponse, error) {
+	a.checks++
+	var res models.ApiAccountResponse
+	res.Data.Role = a.role
+	return res, nil
+}
+
+func (a *countingAccounts) ByKey(ctx context.Context, key string) (models.ApiAccountResponse, error) {
+	return models.ApiAccountResponse{}, nil
+}
+
+func TestCachedAccountCheck(t *testing.T) {
+	inner := &countingAccounts{role: "admin"}
+	client := NewCachedAccountClient(inner, cache.NewLRU(100), DefaultCacheConfig())
+
+	for i := 0; i < 2; i++ {
+		client.Check(context.Background(), AccountCheck{ApiKey: "key", Origin: "https://runet.id"})
+		client.Check(context.Background(), AccountCheck{ApiKey: "key", Hash: "h", Time: strconv.Itoa(i)})
+	}
+	if inner.checks != 3 {
+		t.Fatalf("Expected a cached unsigned check and uncached signed ones, got %d checks", inner.checks)
+	}
+
+	inner.role = "blocked"
+	client.InvalidateKey("key")
+	res, _ := client.Check(context.Background(), AccountCheck{ApiKey: "key", Origin: "https://runet.id"})
+	if res.Data.Role != "blocked" {
+		t.Fatal("Check of an invalidated key served from the cache")
+	}
+}
@@ -0,0 +1,62 @@
+package signature
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// Account is the api account owning a key.
+type Account struct {
+	Id      int64
+	Secret  string
+	EventId int64
+	Role    string
+}
+
+// AccountLookup finds the account of an api key, e.g. in the database of the account service.
+type AccountLookup func(c *gin.Context, apiKey string) (Account, error)
+
+// Middleware verifies signed requests locally and sets event_id, api_account_id and role like AccountMiddleware.
+func Middleware(v *Verifier, lookup AccountLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get(HeaderApiKey)
+		if key == "" {
+			unauthorized(c, ErrMissingHeaders)
+			return
+		}
+
+		account, err := lookup(c, key)
+		if err != nil {
+			unauthorized(c, err)
+			return
+		}
+
+		if err := v.Verify(c.Request, account.Secret); err != nil {
+			if errors.Is(err, ErrBodyTooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Request body too large"})
+				c.Writer.WriteHeaderNow()
+				c.Abort()
+				return
+			}
+			unauthorized(c, err)
+			return
+		}
+
+		c.Set("event_id", account.EventId)
+		if account.Id != 0 {
+			c.Set("api_account_id", account.Id)
+		}
+		c.Set("role", account.Role)
+		c.Set("api_key", key)
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context, err error) {
+	log.Println(err.Error() + " " + c.Request.URL.Path + " traceId " + c.GetString("traceId"))
+	c.JSON(http.StatusUnauthorized, gin.H{"message": "Wrong api key or signature"})
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+}
@@ -0,0 +1,74 @@
+package signature
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/bradfitz/gomemcache/memcache"
+	"sync"
+	"time"
+)
+
+// NonceStore remembers used nonces.
+type NonceStore interface {
+	// Seen records the nonce and reports whether it was recorded before within ttl.
+	Seen(nonce string, ttl time.Duration) bool
+}
+
+type MemoryNonceStore struct {
+	mu      sync.Mutex
+	nonces  map[string]time.Time
+	cleaned time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: map[string]time.Time{}, cleaned: time.Now()}
+}
+
+func (s *MemoryNonceStore) Seen(nonce string, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(s.cleaned) > ttl {
+		for n, expires := range s.nonces {
+			if now.After(expires) {
+				delete(s.nonces, n)
+			}
+		}
+		s.cleaned = now
+	}
+
+	if expires, ok := s.nonces[nonce]; ok && now.Before(expires) {
+		return true
+	}
+
+	s.nonces[nonce] = now.Add(ttl)
+	return false
+}
+
+// MemcacheNonceStore shares nonces between replicas, usually on the CACHE_SRV connection.
+type MemcacheNonceStore struct {
+	client *memcache.Client
+}
+
+func NewMemcacheNonceStore(client *memcache.Client) *MemcacheNonceStore {
+	return &MemcacheNonceStore{client: client}
+}
+
+func (s *MemcacheNonceStore) Seen(nonce string, ttl time.Duration) bool {
+	sum := sha256.Sum256([]byte(nonce))
+	expiration := int32(ttl / time.Second)
+	if expiration < 1 {
+		expiration = 1
+	}
+
+	// Add fails when the key exists, which makes the check atomic across replicas
+	err := s.client.Add(&memcache.Item{
+		Key:        "nonce:" + hex.EncodeToString(sum[:]),
+		Value:      []byte{1},
+		Expiration: expiration,
+	})
+
+	return err == memcache.ErrNotStored
+}
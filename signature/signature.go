@@ -0,0 +1,239 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderApiKey    = "ApiKey"
+	HeaderTime      = "Time"
+	HeaderNonce     = "Nonce"
+	HeaderSignature = "Signature"
+	// legacy md5(key + time + secret) signature
+	HeaderHash = "Hash"
+)
+
+var (
+	ErrMissingHeaders   = errors.New("signature: missing signature headers")
+	ErrInvalidTime      = errors.New("signature: invalid timestamp")
+	ErrClockSkew        = errors.New("signature: timestamp outside of the allowed window")
+	ErrReplay           = errors.New("signature: nonce already used")
+	ErrInvalidSignature = errors.New("signature: invalid signature")
+	ErrLegacyDisabled   = errors.New("signature: md5 signatures are disabled")
+	ErrBodyTooLarge     = errors.New("signature: request body too large")
+)
+
+// StringToSign builds the canonical form of the request:
+// method, path with query, hex sha256 of the body, timestamp and nonce separated by new lines.
+func StringToSign(method string, path string, body []byte, timestamp string, nonce string) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		hex.EncodeToString(sum[:]),
+		timestamp,
+		nonce,
+	}, "\n")
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the canonical request.
+func Sign(secret string, method string, path string, body []byte, timestamp string, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(StringToSign(method, path, body, timestamp, nonce)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// LegacyHash is the md5(key + time + secret) scheme checked by ApiAccount.CheckHash.
+func LegacyHash(key string, timestamp string, secret string) string {
+	h := md5.Sum([]byte(key + timestamp + secret))
+	return hex.EncodeToString(h[:])
+}
+
+type Config struct {
+	// accepted difference between the request timestamp and the server clock
+	MaxSkew time.Duration
+	// accept the md5 Hash header of old clients, still limited by MaxSkew,
+	// a hash is accepted once, so a client can send one request per second
+	AllowLegacyMD5 bool
+	// remembers nonces for 2*MaxSkew, nil disables replay protection
+	Nonces NonceStore
+	// largest body read to verify the signature
+	MaxBodySize int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxSkew:     5 * time.Minute,
+		Nonces:      NewMemoryNonceStore(),
+		MaxBodySize: 10 << 20,
+	}
+}
+
+type Verifier struct {
+	config Config
+	now    func() time.Time
+}
+
+func NewVerifier(config Config) *Verifier {
+	if config.MaxSkew <= 0 {
+		config.MaxSkew = DefaultConfig().MaxSkew
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultConfig().MaxBodySize
+	}
+	return &Verifier{config: config, now: time.Now}
+}
+
+// Verify checks the signature headers of the request against the secret of its api key.
+// The body is read and restored for the following handlers.
+func (v *Verifier) Verify(r *http.Request, secret string) error {
+	key := r.Header.Get(HeaderApiKey)
+	timestamp := r.Header.Get(HeaderTime)
+	signature := r.Header.Get(HeaderSignature)
+
+	if key == "" || timestamp == "" {
+		return ErrMissingHeaders
+	}
+
+	if err := v.checkTime(timestamp); err != nil {
+		return err
+	}
+
+	if signature == "" {
+		hash := r.Header.Get(HeaderHash)
+		if hash == "" {
+			return ErrMissingHeaders
+		}
+		if !v.config.AllowLegacyMD5 {
+			return ErrLegacyDisabled
+		}
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(LegacyHash(key, timestamp, secret))) != 1 {
+			return ErrInvalidSignature
+		}
+		// the hash has no nonce, it is valid for a single request
+		if v.config.Nonces != nil && v.config.Nonces.Seen(key+":"+timestamp+":"+strings.ToLower(hash), 2*v.config.MaxSkew) {
+			return ErrReplay
+		}
+		return nil
+	}
+
+	nonce := r.Header.Get(HeaderNonce)
+	if nonce == "" && v.config.Nonces != nil {
+		return ErrMissingHeaders
+	}
+
+	body, err := readBody(r, v.config.MaxBodySize)
+	if err != nil {
+		return err
+	}
+
+	expected := Sign(secret, r.Method, r.URL.RequestURI(), body, timestamp, nonce)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrInvalidSignature
+	}
+
+	// nonces are recorded only for valid signatures so they can not be burned by third parties
+	if v.config.Nonces != nil && v.config.Nonces.Seen(key+":"+nonce, 2*v.config.MaxSkew) {
+		return ErrReplay
+	}
+
+	return nil
+}
+
+func (v *Verifier) checkTime(timestamp string) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTime
+	}
+
+	skew := v.now().Sub(time.Unix(sec, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > v.config.MaxSkew {
+		return ErrClockSkew
+	}
+	return nil
+}
+
+// readBody reads at most limit bytes, 0 reads the whole body.
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	reader := r.Body
+	if limit > 0 {
+		reader = http.MaxBytesReader(nil, r.Body, limit)
+	}
+
+	body, err := io.ReadAll(reader)
+	r.Body.Close()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, ErrBodyTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// Signer signs outgoing requests of Go clients.
+type Signer struct {
+	ApiKey string
+	Secret string
+	now    func() time.Time
+}
+
+func NewSigner(apiKey string, secret string) *Signer {
+	return &Signer{ApiKey: apiKey, Secret: secret, now: time.Now}
+}
+
+// Sign sets the ApiKey, Time, Nonce and Signature headers, the body is read and restored.
+func (s *Signer) Sign(r *http.Request) error {
+	body, err := readBody(r, 0)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	r.Header.Set(HeaderApiKey, s.ApiKey)
+	r.Header.Set(HeaderTime, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, Sign(s.Secret, r.Method, r.URL.RequestURI(), body, timestamp, nonce))
+	return nil
+}
+
+// Hook signs requests of an httpclient.Client, use it with AddRequestHook.
+func (s *Signer) Hook(r *http.Request) {
+	s.Sign(r)
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
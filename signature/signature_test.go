@@ -0,0 +1,79 @@
+package signature
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	v := NewVerifier(DefaultConfig())
+	signer := NewSigner("key", "secret")
+
+	req := httptest.NewRequest("POST", "/apiaccount?x=1", strings.NewReader(`{"role":"admin"}`))
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Verify(req, "secret"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := v.Verify(req, "secret"); !errors.Is(err, ErrReplay) {
+		t.Fatalf("Expected replay error, got %v", err)
+	}
+
+	tampered := httptest.NewRequest("POST", "/apiaccount?x=1", strings.NewReader(`{"role":"user"}`))
+	signer.Sign(tampered)
+	tampered.Body = httptest.NewRequest("POST", "/", strings.NewReader(`{"role":"admin"}`)).Body
+	if err := v.Verify(tampered, "secret"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected invalid signature, got %v", err)
+	}
+}
+
+func TestClockSkewAndLegacy(t *testing.T) {
+	config := DefaultConfig()
+	v := NewVerifier(config)
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	req := httptest.NewRequest("GET", "/apiaccount/list", nil)
+	req.Header.Set(HeaderApiKey, "key")
+	req.Header.Set(HeaderTime, old)
+	req.Header.Set(HeaderHash, LegacyHash("key", old, "secret"))
+
+	if err := v.Verify(req, "secret"); !errors.Is(err, ErrClockSkew) {
+		t.Fatalf("Expected clock skew error, got %v", err)
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderTime, now)
+	req.Header.Set(HeaderHash, LegacyHash("key", now, "secret"))
+
+	if err := v.Verify(req, "secret"); !errors.Is(err, ErrLegacyDisabled) {
+		t.Fatalf("Expected legacy signatures to be disabled, got %v", err)
+	}
+
+	config.AllowLegacyMD5 = true
+	if err := NewVerifier(config).Verify(req, "secret"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := NewVerifier(config).Verify(req, "secret"); !errors.Is(err, ErrReplay) {
+		t.Fatalf("Expected replay error, got %v", err)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxBodySize = 16
+
+	req := httptest.NewRequest("POST", "/apiaccount", strings.NewReader(strings.Repeat("x", 17)))
+	NewSigner("key", "secret").Sign(req)
+
+	if err := NewVerifier(config).Verify(req, "secret"); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("Expected body too large, got %v", err)
+	}
+}
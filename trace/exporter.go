@@ -0,0 +1,117 @@
+package trace
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// scope is the instrumentation scope of the spans of this module.
+const scope = "github.com/runetid/go-sdk/trace"
+
+// OTLPExporter creates the exporter of OTEL_TRACES_EXPORTER=otlp. It is set by importing
+// github.com/runetid/go-sdk/trace/otlp, so services without OTLP do not depend on grpc and protobuf.
+var OTLPExporter func(ctx context.Context) (sdktrace.SpanExporter, error)
+
+var (
+	provider   *sdktrace.TracerProvider
+	providerMu sync.RWMutex
+)
+
+// SetExporter enables tracing with spans exported in batches, nil disables it. The provider is
+// registered globally with the W3C propagators, so otel-instrumented libraries join the traces.
+func SetExporter(exporter sdktrace.SpanExporter) {
+	var next *sdktrace.TracerProvider
+	if exporter != nil {
+		next = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithIDGenerator(idGenerator{}))
+	}
+
+	providerMu.Lock()
+	old := provider
+	provider = next
+	providerMu.Unlock()
+
+	if next != nil {
+		otel.SetTracerProvider(next)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	} else {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	}
+
+	if old != nil {
+		old.Shutdown(context.Background())
+	}
+}
+
+func tracerProvider() *sdktrace.TracerProvider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	return provider
+}
+
+// Enabled reports whether spans are recorded.
+func Enabled() bool {
+	return tracerProvider() != nil
+}
+
+// Flush exports the pending spans.
+func Flush(ctx context.Context) {
+	if p := tracerProvider(); p != nil {
+		if err := p.ForceFlush(ctx); err != nil {
+			log.Println("Trace: flush failed: " + err.Error())
+		}
+	}
+}
+
+// Shutdown exports the pending spans and disables tracing.
+func Shutdown(ctx context.Context) {
+	providerMu.Lock()
+	p := provider
+	provider = nil
+	providerMu.Unlock()
+
+	if p != nil {
+		if err := p.Shutdown(ctx); err != nil {
+			log.Println("Trace: shutdown failed: " + err.Error())
+		}
+	}
+}
+
+// StartFromEnv configures the exporter with the standard OpenTelemetry variables:
+// OTEL_TRACES_EXPORTER (otlp, console or none), OTEL_EXPORTER_OTLP_ENDPOINT,
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME.
+// Tracing stays disabled unless an exporter or endpoint is set.
+func StartFromEnv() {
+	kind := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER"))
+	if kind == "" && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "") {
+		kind = "otlp"
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch kind {
+	case "otlp":
+		if OTLPExporter == nil {
+			log.Println("Trace: OTLP export requires importing github.com/runetid/go-sdk/trace/otlp")
+			return
+		}
+		exporter, err = OTLPExporter(context.Background())
+	case "console", "stdout":
+		exporter, err = stdouttrace.New()
+	default:
+		return
+	}
+
+	if err != nil {
+		log.Println("Trace: exporter not started: " + err.Error())
+		return
+	}
+	SetExporter(exporter)
+}
@@ -0,0 +1,21 @@
+// Package otlp sends the spans of the trace package with OTLP/HTTP when OTEL_TRACES_EXPORTER is otlp
+// or an OTEL_EXPORTER_OTLP_* endpoint is set, import it for its side effect:
+//
+//	import _ "github.com/runetid/go-sdk/trace/otlp"
+//
+// It is a module of its own, so the grpc and protobuf dependencies of the exporter are only
+// required by services exporting traces.
+package otlp
+
+import (
+	"context"
+	"github.com/runetid/go-sdk/trace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func init() {
+	trace.OTLPExporter = func(ctx context.Context) (sdktrace.SpanExporter, error) {
+		return otlptracehttp.New(ctx)
+	}
+}
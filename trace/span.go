@@ -0,0 +1,164 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+type SpanKind = oteltrace.SpanKind
+
+const (
+	KindInternal = oteltrace.SpanKindInternal
+	KindServer   = oteltrace.SpanKindServer
+	KindClient   = oteltrace.SpanKindClient
+)
+
+// Span is a timed operation of a trace recorded with the OpenTelemetry SDK, exported when it ends.
+// Methods are safe on a nil span, which is returned while tracing is disabled.
+type Span struct {
+	span oteltrace.Span
+}
+
+// SpanKey stores the server span in the gin context, which does not expose Request.Context() values.
+const SpanKey = "traceSpan"
+
+// SpanFromContext returns the current span, also one started by an otel-instrumented library, nil when missing.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	if span := oteltrace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return &Span{span: span}
+	}
+	span, _ := ctx.Value(SpanKey).(*Span)
+	return span
+}
+
+// ContextWithParent continues the trace of a traceparent header in ctx.
+func ContextWithParent(ctx context.Context, traceparent string) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{ParentHeader: traceparent})
+}
+
+// StartSpan starts a child of the current span, of the remote parent or a new root of the trace id of ctx.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	return startSpan(ctx, name, oteltrace.WithSpanKind(kind))
+}
+
+// RecordSpan exports an operation measured elsewhere, e.g. a query reported by the gorm logger.
+func RecordSpan(ctx context.Context, name string, kind SpanKind, start time.Time, attributes map[string]interface{}, err error) {
+	list := make([]attribute.KeyValue, 0, len(attributes))
+	for k, v := range attributes {
+		list = append(list, keyValue(k, v))
+	}
+
+	_, span := startSpan(ctx, name, oteltrace.WithSpanKind(kind), oteltrace.WithTimestamp(start), oteltrace.WithAttributes(list...))
+	span.SetError(err)
+	span.Finish()
+}
+
+func startSpan(ctx context.Context, name string, options ...oteltrace.SpanStartOption) (context.Context, *Span) {
+	provider := tracerProvider()
+	if provider == nil {
+		return ctx, nil
+	}
+
+	if parent, ok := ctx.Value(SpanKey).(*Span); ok && !oteltrace.SpanContextFromContext(ctx).IsValid() {
+		ctx = oteltrace.ContextWithSpan(ctx, parent.span)
+	}
+	ctx, span := provider.Tracer(scope).Start(ctx, name, options...)
+	return ctx, &Span{span: span}
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(keyValue(key, value))
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// Finish ends the span and hands it to the exporter, later calls are ignored.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// SpanContext returns the ids of the span.
+func (s *Span) SpanContext() oteltrace.SpanContext {
+	if s == nil {
+		return oteltrace.SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+// Parent returns the traceparent header of the span for outgoing calls.
+func (s *Span) Parent() string {
+	if s == nil {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(oteltrace.ContextWithSpan(context.Background(), s.span), carrier)
+	return carrier.Get(ParentHeader)
+}
+
+func keyValue(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
+
+// idGenerator uses the trace id of the request for root spans, so X-Trace-Id and the exported trace match.
+type idGenerator struct{}
+
+func (idGenerator) NewIDs(ctx context.Context) (oteltrace.TraceID, oteltrace.SpanID) {
+	var traceId oteltrace.TraceID
+	if id := FromContext(ctx); id != "" {
+		hex.Decode(traceId[:], []byte(spanTraceId(id)))
+	} else {
+		rand.Read(traceId[:])
+	}
+	return traceId, idGenerator{}.NewSpanID(ctx, traceId)
+}
+
+func (idGenerator) NewSpanID(ctx context.Context, traceId oteltrace.TraceID) oteltrace.SpanID {
+	var spanId oteltrace.SpanID
+	rand.Read(spanId[:])
+	return spanId
+}
+
+// spanTraceId converts trace ids of other formats to the 32 hex digits of W3C trace context.
+func spanTraceId(traceId string) string {
+	if id := Hex(traceId); id != "" {
+		return id
+	}
+	sum := sha256.Sum256([]byte(traceId))
+	return hex.EncodeToString(sum[:16])
+}
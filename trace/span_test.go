@@ -0,0 +1,79 @@
+package trace
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracetest.NewInMemoryExporter()
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	var outgoing *http.Request
+	var client *Span
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/event/:id", func(c *gin.Context) {
+		var ctx context.Context
+		ctx, client = StartSpan(c, "HTTP GET", KindClient)
+		outgoing = httptest.NewRequest("GET", "http://event/1", nil).WithContext(ctx)
+		Inject(outgoing)
+		client.Finish()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/event/1", nil)
+	req.Header.Set(ParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	Flush(context.Background())
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	clientSpan, serverSpan := spans[0], spans[1]
+	if serverSpan.Name != "GET /event/:id" || serverSpan.Parent.SpanID().String() != "00f067aa0ba902b7" || serverSpan.Status.Code != codes.Error {
+		t.Fatalf("Unexpected server span %+v", serverSpan)
+	}
+	if clientSpan.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || clientSpan.Parent.SpanID() != serverSpan.SpanContext.SpanID() {
+		t.Fatalf("Client span not a child of the server span: %+v", clientSpan)
+	}
+	if outgoing.Header.Get(ParentHeader) != client.Parent() || client.Parent() == "" {
+		t.Fatalf("Unexpected outgoing traceparent %s", outgoing.Header.Get(ParentHeader))
+	}
+}
+
+func TestForeignSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	// a span of an otel-instrumented library is the parent of ours and the other way round
+	ctx, foreign := otel.Tracer("library").Start(NewContext(context.Background(), "a1b2c3d4-0000-4000-8000-000000000001"), "library call")
+	ctx, span := StartSpan(ctx, "gorm SELECT", KindClient)
+	_, nested := otel.Tracer("library").Start(ctx, "library query")
+	nested.End()
+	span.Finish()
+	foreign.End()
+	Flush(context.Background())
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	if spans[2].SpanContext.TraceID().String() != "a1b2c3d4000040008000000000000001" {
+		t.Fatalf("Root span not of the request trace id: %s", spans[2].SpanContext.TraceID())
+	}
+	if spans[1].Parent.SpanID() != spans[2].SpanContext.SpanID() || spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Fatalf("Spans not nested: %+v", spans)
+	}
+}
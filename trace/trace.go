@@ -0,0 +1,158 @@
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"net/http"
+	"strings"
+)
+
+const (
+	Header       = "X-Trace-Id"
+	ParentHeader = "traceparent"
+	// key of the trace id in the gin context
+	Key = "traceId"
+)
+
+type contextKey struct{}
+
+// New returns a random trace id in the UUID format.
+func New() string {
+	return uuid.New().String()
+}
+
+// NewContext stores the trace id in ctx, outgoing calls made with ctx forward it.
+func NewContext(ctx context.Context, traceId string) context.Context {
+	return context.WithValue(ctx, contextKey{}, traceId)
+}
+
+// FromContext returns the trace id of a request context or of a gin context, empty when missing.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if traceId, ok := ctx.Value(contextKey{}).(string); ok {
+		return traceId
+	}
+	if traceId, ok := ctx.Value(Key).(string); ok {
+		return traceId
+	}
+	return ""
+}
+
+// FromRequest returns the incoming X-Trace-Id, else the trace id of a W3C traceparent header.
+func FromRequest(r *http.Request) string {
+	if traceId := r.Header.Get(Header); valid(traceId) {
+		return traceId
+	}
+	if traceId, _, ok := ParseParent(r.Header.Get(ParentHeader)); ok {
+		return traceId
+	}
+	return ""
+}
+
+// ParseParent returns the trace and parent span ids of a version 00 traceparent header.
+func ParseParent(header string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || parts[0] != "00" || !hexId(parts[1], 32) || !hexId(parts[2], 16) {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// Hex returns the trace id as the 32 hex digits of a traceparent header, empty for foreign formats.
+func Hex(traceId string) string {
+	id := strings.ReplaceAll(strings.ToLower(traceId), "-", "")
+	if !hexId(id, 32) {
+		return ""
+	}
+	return id
+}
+
+// Get returns the trace id of the request, set by Middleware or taken from the headers.
+func Get(c *gin.Context) string {
+	if traceId := c.GetString(Key); traceId != "" {
+		return traceId
+	}
+	return FromRequest(c.Request)
+}
+
+// Middleware accepts the trace id of the caller or generates one, stores it in the gin context
+// and Request.Context() and echoes it in the X-Trace-Id response header.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		traceId := FromRequest(c.Request)
+		if traceId == "" {
+			traceId = New()
+		}
+
+		ctx := NewContext(c.Request.Context(), traceId)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(c.Request.Header))
+
+		name := c.FullPath()
+		if name == "" {
+			name = "unmatched route"
+		}
+		ctx, span := StartSpan(ctx, c.Request.Method+" "+name, KindServer)
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.route", c.FullPath())
+		span.SetAttribute("http.client_ip", c.ClientIP())
+
+		c.Set(Key, traceId)
+		if span != nil {
+			c.Set(SpanKey, span)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(Header, traceId)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(status)))
+		}
+		span.Finish()
+	}
+}
+
+// Inject sets X-Trace-Id and the headers of the registered propagators, e.g. the traceparent of the current span,
+// on an outgoing request unless already set.
+func Inject(r *http.Request) {
+	if r.Header.Get(ParentHeader) == "" {
+		otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+	}
+
+	if r.Header.Get(Header) != "" {
+		return
+	}
+	if traceId := FromContext(r.Context()); traceId != "" {
+		r.Header.Set(Header, traceId)
+	}
+}
+
+// valid accepts ids of printable characters without spaces, so they are safe to log and forward.
+func valid(traceId string) bool {
+	if traceId == "" || len(traceId) > 128 {
+		return false
+	}
+	for _, r := range traceId {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func hexId(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+
+	var fromGin, fromRequest string
+	r.GET("/event", func(c *gin.Context) {
+		fromGin = c.GetString(Key)
+		fromRequest = FromContext(c.Request.Context())
+	})
+
+	request := func(header string, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/event", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(Header, "abc-123")
+	if fromGin != "abc-123" || fromRequest != "abc-123" || w.Header().Get(Header) != "abc-123" {
+		t.Fatalf("Incoming trace id not kept: %s %s %s", fromGin, fromRequest, w.Header().Get(Header))
+	}
+
+	request(ParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if fromGin != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("Trace id of traceparent not used: %s", fromGin)
+	}
+
+	w = request("", "")
+	if fromGin == "" || w.Header().Get(Header) != fromGin {
+		t.Fatal("Trace id not generated")
+	}
+
+	request(Header, "bad id\n")
+	if fromGin == "bad id\n" {
+		t.Fatal("Invalid trace id accepted")
+	}
+}
+
+func TestInject(t *testing.T) {
+	ctx := NewContext(context.Background(), "abc")
+	req := httptest.NewRequest("GET", "/event", nil).WithContext(ctx)
+	Inject(req)
+
+	if req.Header.Get(Header) != "abc" {
+		t.Fatal("Trace id not injected")
+	}
+
+	if Hex("a1b2c3d4-0000-4000-8000-000000000001") != "a1b2c3d4000040008000000000000001" || Hex("abc") != "" {
+		t.Fatal("Unexpected hex trace id")
+	}
+}
@@ -0,0 +1,161 @@
+package sdk
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+type TrustMode string
+
+const (
+	// TrustEnforce trusts only the configured networks and service tokens.
+	TrustEnforce TrustMode = "enforce"
+	// TrustReport trusts the same clients as TrustEnforce and logs requests of clients sharing
+	// a /24 with the host, which may be internal callers missing from the configuration.
+	TrustReport TrustMode = "report"
+)
+
+const ServiceTokenHeader = "X-Service-Token"
+
+// how AccountMiddleware authenticated an internal client, stored in the gin context as internal_auth
+const (
+	InternalByServiceToken = "service_token"
+	InternalByNetwork      = "network"
+)
+
+// TrustConfig decides which clients skip api account authentication in AccountMiddleware.
+type TrustConfig struct {
+	Mode TrustMode
+	// networks of internal clients, e.g. 10.0.0.0/8
+	TrustedCIDRs []string
+	// proxies allowed to set X-Forwarded-For and X-Real-IP, set on the router with SetTrustedProxies
+	TrustedProxies []string
+	// tokens accepted in the X-Service-Token header from other services
+	ServiceTokens []string
+}
+
+// TrustConfigFromEnv reads TRUST_MODE, TRUSTED_CIDRS, TRUSTED_PROXIES and SERVICE_TOKENS, lists are comma separated.
+// The mode is report unless TRUST_MODE=enforce, it only adds the log of subnet neighbours.
+func TrustConfigFromEnv() TrustConfig {
+	mode := TrustMode(strings.ToLower(os.Getenv("TRUST_MODE")))
+	if mode != TrustEnforce {
+		mode = TrustReport
+	}
+
+	return TrustConfig{
+		Mode:           mode,
+		TrustedCIDRs:   splitList(os.Getenv("TRUSTED_CIDRS")),
+		TrustedProxies: splitList(os.Getenv("TRUSTED_PROXIES")),
+		ServiceTokens:  splitList(os.Getenv("SERVICE_TOKENS")),
+	}
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+type trust struct {
+	mode     TrustMode
+	networks []*net.IPNet
+	tokens   [][]byte
+}
+
+func newTrust(config TrustConfig) *trust {
+	t := &trust{mode: config.Mode}
+
+	for _, cidr := range config.TrustedCIDRs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() == nil {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Println("Trust: invalid network " + cidr)
+			continue
+		}
+		t.networks = append(t.networks, network)
+	}
+
+	for _, token := range config.ServiceTokens {
+		t.tokens = append(t.tokens, []byte(token))
+	}
+
+	return t
+}
+
+// trusted checks the service token and the client ip, which honors X-Forwarded-For only from trusted proxies,
+// and returns how the client was authenticated, empty when it is not trusted.
+func (t *trust) trusted(c *gin.Context) string {
+	if token := c.Request.Header.Get(ServiceTokenHeader); token != "" {
+		for _, allowed := range t.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), allowed) == 1 {
+				return InternalByServiceToken
+			}
+		}
+	}
+
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil {
+		return ""
+	}
+
+	for _, network := range t.networks {
+		if network.Contains(ip) {
+			return InternalByNetwork
+		}
+	}
+
+	return ""
+}
+
+// allow returns how the request skipping authentication was authenticated, empty when it is not trusted.
+func (t *trust) allow(c *gin.Context) string {
+	trusted := t.trusted(c)
+
+	// the subnet never grants trust, it only points at callers to configure
+	if t.mode == TrustReport && trusted == "" && legacyTrusted(c.ClientIP()) {
+		log.Println("Trust report: " + c.ClientIP() + " " + c.Request.Method + " " + c.Request.URL.Path + " shares a subnet with the host but is not trusted, add it to TRUSTED_CIDRS or SERVICE_TOKENS if it is internal")
+	}
+
+	return trusted
+}
+
+// legacyTrusted is the former rule, reported only: the client shares a /24 with any local interface.
+func legacyTrusted(clientIP string) bool {
+	_, remoteCIDR, err := net.ParseCIDR(clientIP + "/24")
+	if err != nil {
+		return false
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, a := range addrs {
+		ip, _, pe := net.ParseCIDR(a.String())
+		if pe != nil {
+			continue
+		}
+		_, localCIDR, pe := net.ParseCIDR(ip.String() + "/24")
+		if pe == nil && intersect(localCIDR, remoteCIDR) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,58 @@
+package sdk
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrust(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tr := newTrust(TrustConfig{
+		Mode:          TrustEnforce,
+		TrustedCIDRs:  []string{"10.1.0.0/16", "192.168.0.7"},
+		ServiceTokens: []string{"s3cret"},
+	})
+
+	request := func(remote string, token string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/apiaccount/list", nil)
+		c.Request.RemoteAddr = remote + ":1234"
+		if token != "" {
+			c.Request.Header.Set(ServiceTokenHeader, token)
+		}
+		return c
+	}
+
+	if tr.allow(request("10.1.2.3", "")) != InternalByNetwork || tr.allow(request("192.168.0.7", "")) != InternalByNetwork {
+		t.Fatal("Trusted network rejected")
+	}
+
+	if tr.allow(request("10.2.0.1", "")) != "" || tr.allow(request("192.168.0.8", "")) != "" {
+		t.Fatal("Untrusted network allowed")
+	}
+
+	if tr.allow(request("8.8.8.8", "s3cret")) != InternalByServiceToken || tr.allow(request("8.8.8.8", "wrong")) != "" {
+		t.Fatal("Wrong service token check")
+	}
+}
+
+func TestTrustConfigFromEnv(t *testing.T) {
+	t.Setenv("TRUST_MODE", "")
+	if mode := TrustConfigFromEnv().Mode; mode != TrustReport {
+		t.Fatalf("Expected report mode by default, got %s", mode)
+	}
+
+	// loopback neighbours share a /24 with the host
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/apiaccount/list", nil)
+	c.Request.RemoteAddr = "127.0.0.2:1234"
+	if !legacyTrusted("127.0.0.2") || newTrust(TrustConfigFromEnv()).allow(c) != "" {
+		t.Fatal("Client trusted by subnet in report mode")
+	}
+
+	t.Setenv("TRUST_MODE", "Enforce")
+	if mode := TrustConfigFromEnv().Mode; mode != TrustEnforce {
+		t.Fatalf("Expected enforce mode, got %s", mode)
+	}
+}
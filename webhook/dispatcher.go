@@ -0,0 +1,330 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/runetid/go-sdk/crud"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ResponseLimit is the number of response bytes kept in the delivery log.
+const ResponseLimit = 256
+
+type Config struct {
+	// number of attempts per delivery, including the first one
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	// consecutive failed deliveries after which the subscription is disabled
+	DisableAfter int
+	Workers      int
+	QueueSize    int
+	// how often retries which are due are loaded from the delivery log
+	RetryInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Timeout:        10 * time.Second,
+		DisableAfter:   20,
+		Workers:        4,
+		QueueSize:      1000,
+		RetryInterval:  time.Second,
+	}
+}
+
+// Payload is the JSON body posted to subscribers. Data is the model of the mutation encoded with
+// its json tags like the response of the crud endpoint, fields which partners must not receive
+// need json:"-" or a type rendered as null like db.Secret.
+type Payload struct {
+	Id        string      `json:"id"`
+	Event     string      `json:"event"`
+	EventId   int64       `json:"event_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type job struct {
+	payload Payload
+	body    []byte
+}
+
+type Dispatcher struct {
+	db     *gorm.DB
+	config Config
+	client *http.Client
+	queue  chan job
+}
+
+func NewDispatcher(db *gorm.DB, config Config) *Dispatcher {
+	def := DefaultConfig()
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = def.MaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = def.InitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = def.MaxBackoff
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = def.Timeout
+	}
+	if config.DisableAfter <= 0 {
+		config.DisableAfter = def.DisableAfter
+	}
+	if config.Workers <= 0 {
+		config.Workers = def.Workers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = def.QueueSize
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = def.RetryInterval
+	}
+
+	return &Dispatcher{
+		db:     db,
+		config: config,
+		client: newClient(config.Timeout),
+		queue:  make(chan job, config.QueueSize),
+	}
+}
+
+// Attach publishes every mutation made through the crud endpoints of the application
+// as "<table>.<action>" events and starts the delivery workers.
+func (d *Dispatcher) Attach(ctx context.Context, app *crud.Application) {
+	app.OnMutation(func(event crud.MutationEvent) {
+		var eventId int64
+		if v, ok := event.Ctx.Get("event_id"); ok {
+			eventId, _ = v.(int64)
+		}
+		d.Publish(event.Entity+"."+string(event.Action), eventId, event.Model)
+	})
+
+	d.Start(ctx)
+}
+
+// Start runs the delivery workers and the retry of failed deliveries.
+func (d *Dispatcher) Start(ctx context.Context) {
+	for i := 0; i < d.config.Workers; i++ {
+		go d.work(ctx)
+	}
+	go crud.ScheduleContext(ctx, d.config.RetryInterval, d.retryDue)
+}
+
+// Publish enqueues the event without blocking, events are dropped when the queue is full.
+func (d *Dispatcher) Publish(event string, eventId int64, data interface{}) {
+	payload := Payload{
+		Id:        uuid.New().String(),
+		Event:     event,
+		EventId:   eventId,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("webhook: cant encode payload " + err.Error())
+		return
+	}
+
+	select {
+	case d.queue <- job{payload: payload, body: body}:
+	default:
+		log.Println("webhook: queue is full, dropping " + payload.Id)
+	}
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case j := <-d.queue:
+			d.dispatch(ctx, j)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, j job) {
+	var subscriptions []Subscription
+	err := d.db.WithContext(ctx).
+		Where("active = ? AND (event_id = 0 OR event_id = ?)", true, j.payload.EventId).
+		Find(&subscriptions).Error
+	if err != nil {
+		log.Println("webhook: cant load subscriptions " + err.Error())
+		return
+	}
+
+	for i := range subscriptions {
+		if subscriptions[i].Matches(j.payload.Event, j.payload.EventId) {
+			d.deliver(ctx, &subscriptions[i], j, 1)
+		}
+	}
+}
+
+// deliver makes one attempt, a failed one is stored with the time of the next attempt
+// and the body, so any replica retries it without blocking a worker.
+func (d *Dispatcher) deliver(ctx context.Context, s *Subscription, j job, attempt int) {
+	delivery := d.send(ctx, s, j, attempt)
+	if delivery.Error != "" && attempt < d.config.MaxAttempts {
+		next := time.Now().Add(d.backoff(attempt))
+		delivery.NextAttemptAt = &next
+		delivery.Body = string(j.body)
+	}
+	if err := d.db.Create(&delivery).Error; err != nil {
+		log.Printf("webhook: cant save delivery %s to subscription %d: %s", delivery.DeliveryID, s.ID, err)
+	}
+
+	if delivery.Error == "" {
+		if s.FailureCount > 0 {
+			d.db.Model(s).Update("failure_count", 0)
+		}
+		return
+	}
+
+	if attempt == d.config.MaxAttempts {
+		d.fail(s)
+	}
+}
+
+// backoff is the pause after the attempt, doubling up to MaxBackoff.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.config.InitialBackoff
+	for i := 1; i < attempt && backoff < d.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.config.MaxBackoff {
+		backoff = d.config.MaxBackoff
+	}
+	return backoff
+}
+
+// retryDue sends the next attempt of the deliveries which are due. A delivery is claimed by
+// clearing its next_attempt_at, so it is retried by one replica only.
+func (d *Dispatcher) retryDue(ctx context.Context, now time.Time) {
+	var due []Delivery
+	err := d.db.WithContext(ctx).
+		Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at").
+		Limit(d.config.QueueSize).
+		Find(&due).Error
+	if err != nil {
+		log.Println("webhook: cant load retries " + err.Error())
+		return
+	}
+
+	for _, delivery := range due {
+		tx := d.db.WithContext(ctx).Model(&Delivery{}).
+			Where("id = ? AND next_attempt_at IS NOT NULL", delivery.ID).
+			Updates(map[string]interface{}{"next_attempt_at": nil, "body": ""})
+		if tx.Error != nil || tx.RowsAffected == 0 {
+			continue
+		}
+
+		var s Subscription
+		if err := d.db.WithContext(ctx).Where("id = ? AND active = ?", delivery.SubscriptionID, true).First(&s).Error; err != nil {
+			continue
+		}
+		d.retry(ctx, &s, delivery)
+	}
+}
+
+// retry sends the attempt following the claimed delivery.
+func (d *Dispatcher) retry(ctx context.Context, s *Subscription, delivery Delivery) {
+	j := job{
+		payload: Payload{Id: delivery.DeliveryID, Event: delivery.Event, EventId: delivery.EventID},
+		body:    []byte(delivery.Body),
+	}
+	d.deliver(ctx, s, j, delivery.Attempt+1)
+}
+
+func (d *Dispatcher) send(ctx context.Context, s *Subscription, j job, attempt int) Delivery {
+	delivery := Delivery{
+		SubscriptionID: s.ID,
+		EventID:        s.EventID,
+		DeliveryID:     j.payload.Id,
+		Event:          j.payload.Event,
+		Attempt:        attempt,
+	}
+
+	if err := ValidateURL(s.Url); err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Url, bytes.NewReader(j.body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderId, j.payload.Id)
+	req.Header.Set(HeaderEvent, j.payload.Event)
+	req.Header.Set(HeaderTime, timestamp)
+	req.Header.Set(HeaderSignature, Sign(s.Secret, timestamp, j.body))
+
+	start := time.Now()
+	res, err := d.client.Do(req)
+	delivery.Duration = time.Since(start).Milliseconds()
+
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, ResponseLimit))
+	delivery.StatusCode = res.StatusCode
+	delivery.Response = string(b)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		delivery.Error = fmt.Sprintf("unexpected status %d", res.StatusCode)
+	}
+
+	return delivery
+}
+
+// fail counts a failed delivery in the database, so concurrent workers do not lose increments.
+func (d *Dispatcher) fail(s *Subscription) {
+	err := d.db.Model(s).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "failure_count"}}}).
+		UpdateColumn("failure_count", gorm.Expr("failure_count + 1")).Error
+	if err != nil {
+		log.Printf("webhook: cant count failure of subscription %d: %s", s.ID, err)
+		return
+	}
+
+	if s.FailureCount < d.config.DisableAfter {
+		return
+	}
+
+	now := time.Now()
+	tx := d.db.Model(s).Where("active = ?", true).Updates(map[string]interface{}{
+		"active":          false,
+		"disabled_at":     &now,
+		"disabled_reason": fmt.Sprintf("%d consecutive failed deliveries", s.FailureCount),
+	})
+	if tx.Error != nil {
+		log.Printf("webhook: cant disable subscription %d: %s", s.ID, tx.Error)
+		return
+	}
+	log.Printf("webhook: subscription %d disabled after %d failed deliveries", s.ID, s.FailureCount)
+}
@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/runetid/go-sdk/crud"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Subscription is a partner endpoint receiving callbacks for the listed events.
+// Events is a comma separated list of "<entity>.<action>" names, "*" subscribes to everything.
+type Subscription struct {
+	ID             int        `gorm:"primaryKey;column:id" json:"id"`
+	EventID        int64      `gorm:"column:event_id;index" json:"event_id"`
+	Url            string     `gorm:"column:url" json:"url" binding:"required,url"`
+	Secret         string     `gorm:"column:secret" json:"-"`
+	Events         string     `gorm:"column:events" json:"events"`
+	Active         bool       `gorm:"column:active;index" json:"active"`
+	FailureCount   int        `gorm:"column:failure_count" json:"failure_count"`
+	DisabledAt     *time.Time `gorm:"column:disabled_at" json:"disabled_at"`
+	DisabledReason string     `gorm:"column:disabled_reason" json:"disabled_reason"`
+	CreatedAt      time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at" json:"updated_at"`
+
+	crud.BaseCrudModel `gorm:"-" json:"-"`
+}
+
+// CreatedSubscription is the create response, the only one containing the signing secret.
+type CreatedSubscription struct {
+	*Subscription
+	Secret string `json:"secret"`
+}
+
+func (s *Subscription) TableName() string {
+	return "webhook_subscription"
+}
+
+func (s *Subscription) TenantColumn() string {
+	return "event_id"
+}
+
+// Matches reports whether the subscription should receive the event.
+func (s *Subscription) Matches(event string, eventId int64) bool {
+	if !s.Active {
+		return false
+	}
+
+	if s.EventID != 0 && s.EventID != eventId {
+		return false
+	}
+
+	for _, e := range strings.Split(s.Events, ",") {
+		e = strings.TrimSpace(e)
+		if e == "*" || e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Subscription) List(db *gorm.DB, request crud.ListRequest, ctx *context.Context, params ...crud.FilterParams) (interface{}, int64, error) {
+	var models []Subscription
+
+	query := db.Model(&Subscription{})
+	for _, param := range params {
+		query = query.Where(param.Key+" "+param.Operator+" ?", param.Value)
+	}
+
+	var count int64
+	query.Count(&count)
+
+	err := query.Limit(request.Limit).Offset(request.Offset).Order("id").Find(&models).Error
+	return models, count, err
+}
+
+func (s *Subscription) DecodeCreate(c *gin.Context) (interface{}, error) {
+	m := &Subscription{}
+	if err := c.ShouldBindJSON(m); err != nil {
+		return nil, err
+	}
+
+	if m.Events == "" {
+		m.Events = "*"
+	}
+
+	if err := ValidateURL(m.Url); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s *Subscription) Create(db *gorm.DB, ctx *context.Context) (interface{}, error) {
+	secret, err := NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	s.Secret = secret
+
+	s.Active = true
+	err = db.Create(s).Error
+	return s, err
+}
+
+func (s *Subscription) CreateResponse() interface{} {
+	return CreatedSubscription{Subscription: s, Secret: s.Secret}
+}
+
+// Update replaces the editable fields. Re-enabling a disabled subscription resets its failure counter.
+func (s *Subscription) Update(db *gorm.DB, key string, ctx *context.Context) (interface{}, error) {
+	var model Subscription
+	if err := db.Where("id = ?", key).First(&model).Error; err != nil {
+		return nil, err
+	}
+
+	model.Url = s.Url
+	model.Events = s.Events
+
+	if s.Active && !model.Active {
+		model.Active = true
+		model.FailureCount = 0
+		model.DisabledAt = nil
+		model.DisabledReason = ""
+	}
+
+	err := db.Save(&model).Error
+	return &model, err
+}
+
+func (s *Subscription) Get(db *gorm.DB, key string, ctx *context.Context) (interface{}, error) {
+	var model Subscription
+	tx := db.Where("id = ?", key).First(&model)
+	if tx.RowsAffected < 1 {
+		return nil, errors.New("not found")
+	}
+
+	return &model, tx.Error
+}
+
+func (s *Subscription) Delete(db *gorm.DB, key string, ctx *context.Context) (bool, error) {
+	tx := db.Delete(&Subscription{}, key)
+	return tx.RowsAffected > 0, tx.Error
+}
+
+// Delivery is a single attempt to deliver an event to a subscription,
+// Response keeps the first ResponseLimit bytes of the answer. A failed attempt keeps
+// the body until the next attempt at NextAttemptAt is sent.
+type Delivery struct {
+	ID             int        `gorm:"primaryKey;column:id" json:"id"`
+	SubscriptionID int        `gorm:"column:subscription_id;index" json:"subscription_id"`
+	EventID        int64      `gorm:"column:event_id;index" json:"event_id"`
+	DeliveryID     string     `gorm:"column:delivery_id;index" json:"delivery_id"`
+	Event          string     `gorm:"column:event" json:"event"`
+	Attempt        int        `gorm:"column:attempt" json:"attempt"`
+	StatusCode     int        `gorm:"column:status_code" json:"status_code"`
+	Response       string     `gorm:"column:response" json:"response"`
+	Error          string     `gorm:"column:error" json:"error"`
+	Duration       int64      `gorm:"column:duration_ms" json:"duration_ms"`
+	NextAttemptAt  *time.Time `gorm:"column:next_attempt_at;index" json:"next_attempt_at"`
+	Body           string     `gorm:"column:body" json:"-"`
+	CreatedAt      time.Time  `gorm:"column:created_at" json:"created_at"`
+
+	crud.BaseCrudModel `gorm:"-" json:"-"`
+}
+
+func (d *Delivery) TableName() string {
+	return "webhook_delivery"
+}
+
+func (d *Delivery) TenantColumn() string {
+	return "event_id"
+}
+
+func (d *Delivery) List(db *gorm.DB, request crud.ListRequest, ctx *context.Context, params ...crud.FilterParams) (interface{}, int64, error) {
+	var models []Delivery
+
+	query := db.Model(&Delivery{})
+	for _, param := range params {
+		query = query.Where(param.Key+" "+param.Operator+" ?", param.Value)
+	}
+
+	var count int64
+	query.Count(&count)
+
+	err := query.Limit(request.Limit).Offset(request.Offset).Order("id DESC").Find(&models).Error
+	return models, count, err
+}
+
+func (d *Delivery) GetFilterParams(c *gin.Context) []crud.FilterParams {
+	return []crud.FilterParams{{Key: "subscription_id", Value: c.Param("id"), Operator: "="}}
+}
+
+// AppendEndpoints registers subscription management and the delivery log under prefix.
+func AppendEndpoints(app *crud.Application, prefix string, middlewares ...gin.HandlerFunc) {
+	app.AppendListEndpoint(prefix, &Subscription{}, middlewares...)
+	app.AppendCreateEndpoint(prefix, &Subscription{}, middlewares...)
+	app.AppendGetEndpoint(prefix+"/:id", &Subscription{}, middlewares...)
+	app.AppendUpdateEndpoint(prefix+"/:id", &Subscription{}, middlewares...)
+	app.AppendDeleteEndpoint(prefix+"/:id", &Subscription{}, middlewares...)
+	app.AppendListEndpoint(prefix+"/:id/delivery", &Delivery{}, middlewares...)
+}
@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"event":"api_account.update"}`)
+	signature := Sign("secret", "1700000000", body)
+
+	if !Verify("secret", "1700000000", body, signature) {
+		t.Fatal("Valid signature rejected")
+	}
+
+	if Verify("secret", "1700000001", body, signature) {
+		t.Fatal("Signature accepted for another timestamp")
+	}
+
+	if Verify("other", "1700000000", body, signature) {
+		t.Fatal("Signature accepted for another secret")
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	s := Subscription{Active: true, EventID: 10, Events: "api_account.create, api_account.delete"}
+
+	if !s.Matches("api_account.delete", 10) {
+		t.Fatal("Expected subscription to match")
+	}
+
+	if s.Matches("api_account.update", 10) {
+		t.Fatal("Unexpected match for unsubscribed event")
+	}
+
+	if s.Matches("api_account.create", 11) {
+		t.Fatal("Unexpected match for another event id")
+	}
+
+	s.Active = false
+	if s.Matches("api_account.create", 10) {
+		t.Fatal("Disabled subscription matched")
+	}
+}
+
+// fakeDb records deliveries and keeps failure counters of a dry run connection.
+type fakeDb struct {
+	deliveries []Delivery
+	failures   int
+	disabled   bool
+}
+
+func newFakeDb(t *testing.T) (*gorm.DB, *fakeDb) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeDb{}
+	db.Callback().Create().After("gorm:create").Register("test:create", func(tx *gorm.DB) {
+		if d, ok := tx.Statement.Dest.(*Delivery); ok {
+			fake.deliveries = append(fake.deliveries, *d)
+		}
+	})
+	db.Callback().Update().After("gorm:update").Register("test:update", func(tx *gorm.DB) {
+		s, ok := tx.Statement.Model.(*Subscription)
+		updates, _ := tx.Statement.Dest.(map[string]interface{})
+		if !ok || updates == nil {
+			return
+		}
+		switch v := updates["failure_count"].(type) {
+		case clause.Expr:
+			fake.failures++
+			s.FailureCount = fake.failures
+		case int:
+			fake.failures = v
+		}
+		if active, ok := updates["active"]; ok && active == false {
+			fake.disabled = true
+		}
+	})
+	return db, fake
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	AllowPrivateTargets = true
+	defer func() { AllowPrivateTargets = false }()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !Verify("secret", r.Header.Get(HeaderTime), []byte(`{}`), r.Header.Get(HeaderSignature)) {
+			t.Error("Unsigned delivery")
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(strings.Repeat("x", 2*ResponseLimit)))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	db, fake := newFakeDb(t)
+	d := NewDispatcher(db, Config{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 1500 * time.Millisecond})
+	s := &Subscription{ID: 1, Url: server.URL, Secret: "secret", Active: true, FailureCount: 2}
+
+	start := time.Now()
+	d.deliver(context.Background(), s, job{payload: Payload{Id: "1", Event: "api_account.create"}, body: []byte(`{}`)}, 1)
+	if len(fake.deliveries) != 1 || time.Since(start) > time.Second {
+		t.Fatal("Worker blocked until the next attempt")
+	}
+	// the attempts loaded by retryDue
+	d.retry(context.Background(), s, fake.deliveries[0])
+	d.retry(context.Background(), s, fake.deliveries[1])
+
+	first, second := fake.deliveries[0].NextAttemptAt, fake.deliveries[1].NextAttemptAt
+	if first == nil || first.Before(start.Add(time.Second)) || fake.deliveries[0].Body != `{}` {
+		t.Fatalf("Retry not scheduled after the backoff: %+v", fake.deliveries[0])
+	}
+	if second == nil || second.Before(start.Add(1500*time.Millisecond)) || second.After(time.Now().Add(1500*time.Millisecond)) {
+		t.Fatalf("Backoff not capped: %v %v", first, second)
+	}
+	if fake.deliveries[2].NextAttemptAt != nil || fake.deliveries[2].Body != "" {
+		t.Fatal("Retry scheduled after a successful delivery")
+	}
+	if len(fake.deliveries) != 3 {
+		t.Fatalf("Logged %d deliveries", len(fake.deliveries))
+	}
+	for i, delivery := range fake.deliveries {
+		if delivery.Attempt != i+1 || delivery.DeliveryID != "1" || len(delivery.Response) > ResponseLimit {
+			t.Fatalf("Delivery %+v", delivery)
+		}
+	}
+	if fake.deliveries[0].StatusCode != http.StatusBadGateway || fake.deliveries[0].Error == "" ||
+		fake.deliveries[2].StatusCode != http.StatusOK || fake.deliveries[2].Error != "" {
+		t.Fatalf("Deliveries %+v", fake.deliveries)
+	}
+	if fake.failures != 0 {
+		t.Fatal("Failure counter not reset by a successful delivery")
+	}
+}
+
+func TestDisableAfterFailures(t *testing.T) {
+	AllowPrivateTargets = true
+	defer func() { AllowPrivateTargets = false }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	db, fake := newFakeDb(t)
+	d := NewDispatcher(db, Config{MaxAttempts: 1, DisableAfter: 3})
+	s := &Subscription{ID: 1, Url: server.URL, Secret: "secret", Active: true}
+
+	for i := 0; i < 3; i++ {
+		if fake.disabled {
+			t.Fatalf("Disabled after %d failures", i)
+		}
+		d.deliver(context.Background(), s, job{payload: Payload{Id: "1"}, body: []byte(`{}`)}, 1)
+	}
+
+	if !fake.disabled || fake.failures != 3 {
+		t.Fatalf("Not disabled after %d failures", fake.failures)
+	}
+}
+
+func TestPrivateTargets(t *testing.T) {
+	for _, u := range []string{"http://127.0.0.1/hook", "http://10.0.0.1/hook", "http://169.254.169.254/latest", "http://[::1]/hook", "http://localhost:8080", "ftp://partner.example/hook"} {
+		if ValidateURL(u) == nil {
+			t.Fatalf("%s accepted", u)
+		}
+	}
+	if err := ValidateURL("https://partner.example/hook"); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// ValidateURL passes names, the address is checked when connecting
+	_, err := newClient(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrForbiddenTarget) {
+		t.Fatalf("Loopback connection: %v", err)
+	}
+}